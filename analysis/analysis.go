@@ -1,41 +1,106 @@
-// This package contains methods to analyze a CODEOWNERS file. Assumes that the current directory is the
-// root of a Git repo, which contains the CODEOWNERS file in one of GitLab's 3 supported locations - see
-// https://docs.gitlab.com/ee/user/project/codeowners/#codeowners-file
+// This package contains methods to analyze a CODEOWNERS file. Assumes that the current directory (or the
+// anatomy's RepoRoot, if set) is the root of a Git repo, which contains the CODEOWNERS file in one of GitLab's 3
+// supported locations - see https://docs.gitlab.com/ee/user/project/codeowners/#codeowners-file
+// Make an anatomy with New(), and call one of the DetermineCodeownersPath methods before analyzing.
 package analysis
 
 import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"errors"
 	"fmt"
+	"io/fs"
 	"log/slog"
+	"net/mail"
 	"os"
+	"path/filepath"
 	"slices"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
-var Co CodeownersFileAnatomy
+// Return an empty anatomy for the CODEOWNERS file of the repo at repoRoot. Each anatomy holds one file, so that
+// several files (or repos) can be analyzed at once, ex: from concurrent goroutines, one anatomy per goroutine.
+func New(repoRoot string) *CodeownersFileAnatomy {
+	return &CodeownersFileAnatomy{RepoRoot: repoRoot}
+}
 
-func init() {
-	err := Co.determineCodeownersPath()
-	if err != nil {
-		panic(err.Error())
-	}
+// Upper limit for a single line when streaming the CODEOWNERS file with AnalyzeStreaming()
+const maxStreamingLineBytes = 16 * 1024 * 1024
+
+// GitLab's 3 supported locations for CODEOWNERS files, in order of precedence
+var supportedLocations = [...]string{"CODEOWNERS", "docs/CODEOWNERS", ".gitlab/CODEOWNERS"}
+
+// Check GitLab's 3 supported locations for CODEOWNERS files in the file system, in order of precedence,
+// followed by co.ExtraLocations, and save the path of the first one found.
+func (co *CodeownersFileAnatomy) DetermineCodeownersPath() error {
+	return co.determineCodeownersPath(func(filePath string) (bool, error) {
+		return fileExists(filepath.Join(co.RepoRoot, filePath))
+	})
+}
+
+// Check GitLab's 3 supported locations for CODEOWNERS files against a list of the repo's file paths (ex:
+// from a bare repo, which has no working tree), in order of precedence, followed by co.ExtraLocations, and save
+// the path of the first one found. Note that this check is case sensitive, just like GitLab's.
+func (co *CodeownersFileAnatomy) DetermineCodeownersPathInRepoFiles(repoFiles []string) error {
+	return co.determineCodeownersPath(func(filePath string) (bool, error) {
+		return slices.Contains(repoFiles, filePath), nil
+	})
 }
 
-// Check GitLab's 3 supported locations for CODEOWNERS files, in order of precedence, and save the
-// path of the first one found.
-func (co *CodeownersFileAnatomy) determineCodeownersPath() error {
-	supportedLocations := [...]string{"CODEOWNERS", "docs/CODEOWNERS", ".gitlab/CODEOWNERS"}
-	for _, location := range supportedLocations {
-		coExists, err := fileExists(location)
+// Check each supported location with the exists function, in order of precedence, and save the path of
+// the first one found. All of the locations are checked, so that any others that are found are saved in
+// co.IgnoredLocations, since GitLab only uses the first one. The extra locations come after the supported ones,
+// so they never take precedence over them. Since they're configured, one that exists but isn't a file (ex: a
+// directory) is an error, rather than skipped.
+func (co *CodeownersFileAnatomy) determineCodeownersPath(exists func(filePath string) (bool, error)) error {
+	co.CodeownersFilePath = ""
+	co.IgnoredLocations = []string{}
+	locations := append(supportedLocations[:], co.ExtraLocations...)
+	for i, location := range locations {
+		coExists, err := exists(location)
 		if err != nil {
+			if i >= len(supportedLocations) && !errors.Is(err, fs.ErrNotExist) {
+				return fmt.Errorf("extra CODEOWNERS location '%v' can't be used: %w", location, err)
+			}
 			slog.Debug(err.Error())
 		}
-		if coExists {
+		switch {
+		case coExists && co.CodeownersFilePath == "":
 			slog.Debug("Found CODEOWNERS file at location `" + location + "'")
 			co.CodeownersFilePath = location
-			return nil
+		case coExists:
+			slog.Debug("Found another CODEOWNERS file at location `" + location + "', which GitLab ignores")
+			co.IgnoredLocations = append(co.IgnoredLocations, location)
 		}
 	}
-	return fmt.Errorf("unable to find a CODEOWNERS file at GitLab's 3 supported paths: %v", supportedLocations)
+	if co.CodeownersFilePath == "" && len(co.ExtraLocations) > 0 {
+		return fmt.Errorf("unable to find a CODEOWNERS file at GitLab's 3 supported paths: %v, or the extra locations: %v",
+			supportedLocations, co.ExtraLocations)
+	}
+	if co.CodeownersFilePath == "" {
+		return fmt.Errorf("unable to find a CODEOWNERS file at GitLab's 3 supported paths: %v", supportedLocations)
+	}
+	return nil
+}
+
+// Split the path of a CODEOWNERS file (ex: checkouts/my-repo/docs/CODEOWNERS) into the root of its repo and its
+// location within the repo, which must be one of GitLab's 3 supported locations.
+func SplitCodeownersFilePath(filePath string) (repoRoot string, location string, err error) {
+	slashPath := filepath.ToSlash(filepath.Clean(filePath))
+	// Check the longest locations first, since "CODEOWNERS" is also the end of the others
+	for i := len(supportedLocations) - 1; i >= 0; i-- {
+		location = supportedLocations[i]
+		if slashPath == location {
+			return ".", location, nil
+		}
+		if root, found := strings.CutSuffix(slashPath, "/"+location); found {
+			return filepath.FromSlash(cmp.Or(root, "/")), location, nil
+		}
+	}
+	return "", "", fmt.Errorf("CODEOWNERS file '%v' is not at one of GitLab's 3 supported paths: %v", filePath, supportedLocations)
 }
 
 // Return whether or not the specified file can be found within the file system. Note that Linux has a case
@@ -56,48 +121,303 @@ func fileExists(filePath string) (bool, error) {
 	}
 }
 
-// Analyze the CODEOWNERS file that init() stored in co, and store the analysis data there too.
+// Analyze the CODEOWNERS file at co's path (or the lines already loaded into co), and store the analysis data
+// in co too.
 func (co *CodeownersFileAnatomy) Analyze() {
 	// Read in the CODEOWNERS file
-	if len(co.CodeownersFileLines) == 0 {
+	if co.CodeownersFileLines == nil {
 		co.readCodeownersFile()
 	}
-	// Define sets (string map of bool) to record unique patterns with no dupes, since we only
-	// want to analyze a pattern once
-	sectionHeadingsMap := map[string]bool{}
-	filePatternsMap := map[string]bool{}
-	userAndGroupPatternsMap := map[string]bool{}
-	emailPatternsMap := map[string]bool{}
-	ignoredPatternsMap := map[string]bool{}
 	// Analyze each line of the CODEOWNERS file
-	for _, l := range co.CodeownersFileLines {
-		slog.Debug("Processing line '" + l + "'")
-		sectionHeading, filePattern, ownerPatterns := splitCodeownersLine(l)
-		slog.Debug(fmt.Sprintf("Section Heading: '%v', File Pattern: '%v', Owner Pattern(s): '%v'",
-			sectionHeading, filePattern, ownerPatterns))
-		sectionHeadingsMap[sectionHeading] = true
-		filePatternsMap[filePattern] = true
-		usersOrGroups, emails, ignored := splitOwnerPatterns(ownerPatterns)
-		slog.Debug(fmt.Sprintf("usersOrGroups: '%v', emails: '%v', ignored: '%v'",
-			usersOrGroups, emails, ignored))
-		for _, ug := range usersOrGroups {
-			// Remove the "@" owner prefix, since it is not actually part of a GitLab username or group name
-			userAndGroupPatternsMap[strings.TrimPrefix(ug, "@")] = true
-		}
-		for _, e := range emails {
-			emailPatternsMap[e] = true
-		}
-		for _, i := range ignored {
-			ignoredPatternsMap[i] = true
-		}
-	}
-	// Save the unique patterns in the co object
+	sets := newPatternSets()
+	for i, l := range co.CodeownersFileLines {
+		sets.addLine(i+1, l)
+	}
+	co.savePatternSets(sets)
+}
+
+// Analyze the CODEOWNERS file the same way as Analyze(), but stream it in one line at a time instead of
+// reading the whole file into memory first. This keeps peak memory low for very large (usually generated)
+// CODEOWNERS files. Note that CodeownersFileLines is NOT populated, so use Analyze() when the raw lines are
+// needed (ex: for line-number tracking). Returns an error if the file can't be read, or if a line is longer than
+// the streaming limit, in which case co isn't changed.
+func (co *CodeownersFileAnatomy) AnalyzeStreaming() error {
+	file, err := os.Open(filepath.Join(co.RepoRoot, co.CodeownersFilePath))
+	if err != nil {
+		return fmt.Errorf("unable to read CODEOWNERS file at path '%v': %w", co.CodeownersFilePath, err)
+	}
+	defer file.Close()
+	sets := newPatternSets()
+	scanner := bufio.NewScanner(file)
+	scanner.Split(scanLinesAnyEnding)
+	// A single line with thousands of owners can easily exceed the Scanner's default 64KB line limit
+	scanner.Buffer(make([]byte, 0, 64*1024), maxStreamingLineBytes)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		sets.addLine(lineNumber, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("unable to stream CODEOWNERS file at path '%v': %w", co.CodeownersFilePath, err)
+	}
+	co.savePatternSets(sets)
+	return nil
+}
+
+// Return an error if the CODEOWNERS content isn't valid UTF-8, ex: a file that was saved as UTF-16 or Latin-1,
+// which would otherwise parse into garbled patterns that all fail their lookups. Checks the lines that are
+// already loaded into co, or else streams the file at co's path.
+func (co *CodeownersFileAnatomy) CheckEncoding() error {
+	if co.CodeownersFileLines != nil {
+		for i, l := range co.CodeownersFileLines {
+			if !isUtf8Text(l) {
+				return co.encodingError(i+1, l)
+			}
+		}
+		return nil
+	}
+	file, err := os.Open(filepath.Join(co.RepoRoot, co.CodeownersFilePath))
+	if err != nil {
+		return fmt.Errorf("unable to read CODEOWNERS file at path '%v': %w", co.CodeownersFilePath, err)
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Split(scanLinesAnyEnding)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxStreamingLineBytes)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		if !isUtf8Text(scanner.Text()) {
+			return co.encodingError(lineNumber, scanner.Text())
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("unable to stream CODEOWNERS file at path '%v': %w", co.CodeownersFilePath, err)
+	}
+	return nil
+}
+
+// Return true if the line is valid UTF-8 text. NUL bytes are valid UTF-8, but they're never in a text file, so
+// they mean that the file is really UTF-16 or UTF-32 (without a byte order mark).
+func isUtf8Text(line string) bool {
+	return utf8.ValidString(line) && !strings.Contains(line, "\x00")
+}
+
+// Return an error for the first line that isn't valid UTF-8, naming the encoding that the file was likely saved in
+func (co *CodeownersFileAnatomy) encodingError(lineNumber int, line string) error {
+	likelyEncoding := "Latin-1 or Windows-1252"
+	switch {
+	case strings.HasPrefix(line, "\xff\xfe") || strings.HasPrefix(line, "\xfe\xff"):
+		likelyEncoding = "UTF-16 (it has a UTF-16 byte order mark)"
+	case strings.Contains(line, "\x00"):
+		likelyEncoding = "UTF-16 or UTF-32 (it has NUL bytes)"
+	}
+	return fmt.Errorf("CODEOWNERS file at path '%v' is not valid UTF-8 on line %d, it was likely saved as %v, "+
+		"so save it as UTF-8 instead", co.CodeownersFilePath, lineNumber, likelyEncoding)
+}
+
+// Define sets (string map of bool) to record unique patterns with no dupes, since we only want to
+// analyze a pattern once
+func newPatternSets() patternSets {
+	return patternSets{
+		sectionHeadings:      map[string]bool{},
+		filePatterns:         map[string]bool{},
+		userAndGroupPatterns: map[string]bool{},
+		wildcardOwners:       map[string]bool{},
+		roleOwners:           map[string]bool{},
+		specialOwners:        map[string]bool{},
+		emailPatterns:        map[string]bool{},
+		malformedEmails:      map[string]bool{},
+		ignoredPatterns:      map[string]bool{},
+		ownerLines:           map[string][]int{},
+		filePatternLines:     map[string][]int{},
+		sections:             &[]Section{{DefaultOwners: []string{}, Entries: []Entry{}}},
+	}
+}
+
+// Split a single CODEOWNERS line into its patterns, and record each of them in the sets. lineNumber
+// starts at 1, and is used to remember which line(s) each owner pattern came from.
+func (sets patternSets) addLine(lineNumber int, l string) {
+	slog.Debug("Processing line '" + l + "'")
+	sectionHeading, filePattern, ownerPatterns := SplitCodeownersLine(l)
+	slog.Debug(fmt.Sprintf("Section Heading: '%v', File Pattern: '%v', Owner Pattern(s): '%v'",
+		sectionHeading, filePattern, ownerPatterns))
+	sets.sectionHeadings[sectionHeading] = true
+	sets.filePatterns[filePattern] = true
+	if filePattern != "" {
+		sets.filePatternLines[filePattern] = append(sets.filePatternLines[filePattern], lineNumber)
+	}
+	usersOrGroups, specialOwners, emails, malformedEmails, ignored := splitOwnerPatterns(ownerPatterns)
+	slog.Debug(fmt.Sprintf("usersOrGroups: '%v', specialOwners: '%v', emails: '%v', malformedEmails: '%v', ignored: '%v'",
+		usersOrGroups, specialOwners, emails, malformedEmails, ignored))
+	sets.addToSections(lineNumber, sectionHeading, filePattern, ownerPatterns)
+	for _, ug := range usersOrGroups {
+		// Remove the "@" owner prefix, since it is not actually part of a GitLab username or group name
+		ug = strings.TrimPrefix(ug, "@")
+		// GitLab doesn't support wildcards in owners, so don't mistake them for a real username or group
+		if strings.ContainsAny(ug, "*?[") {
+			sets.wildcardOwners[ug] = true
+		} else {
+			sets.userAndGroupPatterns[ug] = true
+		}
+		sets.addOwnerLine(ug, lineNumber)
+	}
+	for _, so := range specialOwners {
+		// Keep the "@@" prefix, so that a role (ex: @@developer) isn't mistaken for a user with the same name
+		if slices.Contains(RoleOwnerPatterns, strings.ToLower(so)) {
+			sets.roleOwners[so] = true
+		} else {
+			sets.specialOwners[so] = true
+		}
+		sets.addOwnerLine(so, lineNumber)
+	}
+	for _, e := range emails {
+		sets.emailPatterns[e] = true
+		sets.addOwnerLine(e, lineNumber)
+	}
+	for _, e := range malformedEmails {
+		sets.malformedEmails[e] = true
+		sets.addOwnerLine(e, lineNumber)
+	}
+	for _, i := range ignored {
+		sets.ignoredPatterns[i] = true
+		sets.addOwnerLine(i, lineNumber)
+	}
+}
+
+// Record a section heading or file pattern entry in the sections. Entries are added to the latest section.
+func (sets patternSets) addToSections(lineNumber int, sectionHeading string, filePattern string, ownerPatterns string) {
+	owners := strings.Fields(ownerPatterns)
+	switch {
+	case sectionHeading != "":
+		section := parseSectionHeading(sectionHeading)
+		section.Line = lineNumber
+		section.DefaultOwners = owners
+		section.Entries = []Entry{}
+		*sets.sections = append(*sets.sections, section)
+	case filePattern != "":
+		current := &(*sets.sections)[len(*sets.sections)-1]
+		current.Entries = append(current.Entries, Entry{FilePattern: filePattern, Owners: owners, Line: lineNumber})
+	}
+}
+
+// Parse a section heading, ex: "^[Security][2]" is an optional section named "Security" that requires 2
+// approvals. Unexpected text after the heading is ignored (the syntax check catches it).
+func parseSectionHeading(heading string) (section Section) {
+	section.Heading = heading
+	remainder, optional := strings.CutPrefix(heading, "^")
+	section.Optional = optional
+	remainder = strings.TrimPrefix(remainder, "[")
+	// Find the first un-escaped "]"
+	end := -1
+	for i := 0; i < len(remainder); i++ {
+		if remainder[i] == ']' && !IsEscaped(remainder, i) {
+			end = i
+			break
+		}
+	}
+	if end == -1 {
+		section.Name = strings.ReplaceAll(remainder, `\]`, "]")
+		return
+	}
+	// The escape isn't part of the name, ex: "[Weird\]Name]" is named "Weird]Name"
+	section.Name = strings.ReplaceAll(remainder[:end], `\]`, "]")
+	remainder = remainder[end+1:]
+	if strings.HasPrefix(remainder, "[") && strings.HasSuffix(remainder, "]") {
+		// Only digits are a count, so "[-1]" or "[+2]" is ignored, like any other unexpected text
+		count, err := strconv.Atoi(remainder[1 : len(remainder)-1])
+		if err == nil && !strings.ContainsAny(remainder, "+-") {
+			section.ApprovalCount = count
+		}
+	}
+	return
+}
+
+// Remember that the owner pattern appears on lineNumber, without recording the same line twice
+func (sets patternSets) addOwnerLine(owner string, lineNumber int) {
+	lines := sets.ownerLines[owner]
+	if len(lines) > 0 && lines[len(lines)-1] == lineNumber {
+		return
+	}
+	sets.ownerLines[owner] = append(lines, lineNumber)
+}
+
+// Save the unique patterns from the sets in the co object
+func (co *CodeownersFileAnatomy) savePatternSets(sets patternSets) {
 	co.Analyzed = true
-	co.SectionHeadings = setMapToSlice(sectionHeadingsMap)
-	co.FilePatterns = setMapToSlice(filePatternsMap)
-	co.UserAndGroupPatterns = setMapToSlice(userAndGroupPatternsMap)
-	co.EmailPatterns = setMapToSlice(emailPatternsMap)
-	co.IgnoredPatterns = setMapToSlice(ignoredPatternsMap)
+	co.SectionHeadings = setMapToSlice(sets.sectionHeadings)
+	co.FilePatterns = setMapToSlice(sets.filePatterns)
+	co.UserAndGroupPatterns = setMapToSlice(sets.userAndGroupPatterns)
+	co.WildcardOwners = setMapToSlice(sets.wildcardOwners)
+	co.RoleOwners = setMapToSlice(sets.roleOwners)
+	co.SpecialOwners = setMapToSlice(sets.specialOwners)
+	co.EmailPatterns = setMapToSlice(sets.emailPatterns)
+	co.MalformedEmails = setMapToSlice(sets.malformedEmails)
+	co.IgnoredPatterns = setMapToSlice(sets.ignoredPatterns)
+	co.OwnerLines = sets.ownerLines
+	co.FilePatternLines = sets.filePatternLines
+	co.Sections = *sets.sections
+	// Drop the leading section with no name, if there weren't any entries before the first heading
+	if len(co.Sections[0].Entries) == 0 {
+		co.Sections = co.Sections[1:]
+	}
+	co.DuplicateSections = findDuplicateSections(co.Sections)
+	co.OwnerFilePatterns = findOwnerFilePatterns(co.Sections, co.OwnerLines)
+}
+
+// Return the file patterns that each owner in ownerLines applies to. An entry's own owners replace its section's
+// default owners, so the default owners only apply to the entries without any, ex: "[Docs] @alice" followed only
+// by "*.md @bob" means that @alice doesn't apply to any file pattern.
+func findOwnerFilePatterns(sections []Section, ownerLines map[string][]int) (ownerFilePatterns map[string][]string) {
+	ownerFilePatterns = map[string][]string{}
+	for owner := range ownerLines {
+		ownerFilePatterns[owner] = []string{}
+	}
+	for _, section := range sections {
+		for _, entry := range section.Entries {
+			owners := entry.Owners
+			if len(owners) == 0 {
+				owners = section.DefaultOwners
+			}
+			for _, owner := range owners {
+				key := OwnerLinesKey(owner)
+				if !slices.Contains(ownerFilePatterns[key], entry.FilePattern) {
+					ownerFilePatterns[key] = append(ownerFilePatterns[key], entry.FilePattern)
+				}
+			}
+		}
+	}
+	return
+}
+
+// Return an owner as written (ex: "@alice") in the form that OwnerLines is keyed by, ex: "alice". Users and groups
+// lose their "@" prefix, but "@@" patterns (ex: @@developer) and emails are kept as they are.
+func OwnerLinesKey(owner string) string {
+	if strings.HasPrefix(owner, "@@") {
+		return owner
+	}
+	return strings.TrimPrefix(owner, "@")
+}
+
+// Return the heading line numbers of each section name that is declared more than once. Section names are
+// case-insensitive, and the approval count and "^" are ignored, so "[Backend]", "[backend][2]", and
+// "^[Backend]" are all the same section. Keyed by the name as it was first declared.
+func findDuplicateSections(sections []Section) (duplicates map[string][]int) {
+	duplicates = map[string][]int{}
+	firstNames := map[string]string{} // Lowercase name -> name as it was first declared
+	headingLines := map[string][]int{}
+	for _, section := range sections {
+		if section.Heading == "" {
+			continue
+		}
+		lowerName := strings.ToLower(section.Name)
+		if _, seen := firstNames[lowerName]; !seen {
+			firstNames[lowerName] = section.Name
+		}
+		headingLines[lowerName] = append(headingLines[lowerName], section.Line)
+	}
+	for lowerName, lines := range headingLines {
+		if len(lines) > 1 {
+			duplicates[firstNames[lowerName]] = lines
+		}
+	}
+	return
 }
 
 // Convert a map that was used as a set (list of *unique* strings) into a slice of sorted strings
@@ -116,24 +436,139 @@ func setMapToSlice(m map[string]bool) []string {
 }
 
 func (co *CodeownersFileAnatomy) readCodeownersFile() {
-	content, err := os.ReadFile(co.CodeownersFilePath)
+	content, err := os.ReadFile(filepath.Join(co.RepoRoot, co.CodeownersFilePath))
 	if err != nil {
 		err = fmt.Errorf("unable to read CODEOWNERS file at path '%v': %w", co.CodeownersFilePath, err)
 		panic(err.Error())
 	}
-	// Cast the []byte content to a string, and split it on Windows + Linux line endings
-	co.CodeownersFileLines = strings.Split(strings.ReplaceAll(string(content), "\r\n", "\n"), "\n")
+	co.LoadContent(string(content))
+}
+
+// Load the content of a CODEOWNERS file into co, for when it doesn't come from co's path on the file system
+// (ex: when it's read out of a bare repo). Analyze() will then use these lines instead of reading the file.
+func (co *CodeownersFileAnatomy) LoadContent(content string) {
+	// Normalize Windows (\r\n) and old Mac (\r) line endings to Linux (\n), and then split the content
+	content = strings.ReplaceAll(strings.ReplaceAll(content, "\r\n", "\n"), "\r", "\n")
+	// A final newline ends the last line, rather than starting a new (empty) one
+	content = strings.TrimSuffix(content, "\n")
+	co.CodeownersFileLines = []string{} // not nil, even if the content is empty, so that it's not read again
+	if content != "" {
+		co.CodeownersFileLines = strings.Split(content, "\n")
+	}
+}
+
+// A bufio.SplitFunc like bufio.ScanLines, except that lines may end with \n, \r\n, or a lone \r
+func scanLinesAnyEnding(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	i := bytes.IndexAny(data, "\r\n")
+	switch {
+	case i >= 0 && data[i] == '\n':
+		return i + 1, data[:i], nil
+	case i >= 0 && i+1 < len(data) && data[i+1] == '\n':
+		return i + 2, data[:i], nil
+	case i >= 0 && (i+1 < len(data) || atEOF):
+		return i + 1, data[:i], nil
+	case i < 0 && atEOF:
+		return len(data), data, nil
+	}
+	// Request more data, ex: to see whether a \r at the end of the buffer is followed by a \n
+	return 0, nil, nil
 }
 
-// Split the owner portion of a CODEOWNERS line into its individual @user/@group and email patterns
+// Return a description of each whitespace problem in the raw CodeownersFileLines, ex: "line 4: trailing
+// whitespace". These are legal, but they cause confusing diffs. Requires Analyze() (not AnalyzeStreaming()),
+// since the raw lines are needed.
+func (co *CodeownersFileAnatomy) FindWhitespaceProblems() (problems []string) {
+	for i, l := range co.CodeownersFileLines {
+		lineNumber := strconv.Itoa(i + 1)
+		if l != strings.TrimRight(l, " \t") {
+			problems = append(problems, "line "+lineNumber+": trailing whitespace")
+		}
+		// Look for mixed tabs and spaces in the separators of the owner section (everything after the
+		// [section heading] or file pattern)
+		sectionHeading, filePattern, _ := SplitCodeownersLine(l)
+		trimmedLine := strings.TrimSpace(l)
+		ownerSection := trimmedLine[len(sectionHeading)+len(filePattern):]
+		if strings.Contains(ownerSection, " ") && strings.Contains(ownerSection, "\t") {
+			problems = append(problems, "line "+lineNumber+": mixed tabs and spaces in the owner section")
+		}
+	}
+	return
+}
+
+// Return a description of each line whose file pattern (or section heading) is separated from its owners by
+// anything other than a single space, ex: "line 7: separated by a tab". GitLab accepts any whitespace, but some style
+// guides require a single space. Requires Analyze() (not AnalyzeStreaming()), since the raw lines are needed.
+func (co *CodeownersFileAnatomy) FindSeparatorProblems() (problems []string) {
+	for i, l := range co.CodeownersFileLines {
+		sectionHeading, filePattern, _ := SplitCodeownersLine(l)
+		if sectionHeading == "" && filePattern == "" {
+			continue
+		}
+		trimmedLine := strings.TrimSpace(l)
+		ownerSection := trimmedLine[len(sectionHeading)+len(filePattern):]
+		separator := ownerSection[:len(ownerSection)-len(strings.TrimLeft(ownerSection, " \t"))]
+		switch {
+		case separator == "" || separator == " ":
+			continue
+		case strings.Contains(separator, "\t"):
+			problems = append(problems, fmt.Sprintf("line %d: separated by a tab", i+1))
+		default:
+			problems = append(problems, fmt.Sprintf("line %d: separated by %d spaces", i+1, len(separator)))
+		}
+	}
+	return
+}
+
+// Return the line numbers and lengths of the lines that are longer than maxLength characters, longest first,
+// ex: "line 12: 40213 characters". Requires Analyze() (not AnalyzeStreaming()), since the raw lines are needed.
+func (co *CodeownersFileAnatomy) FindLongLines(maxLength int) (longLines []string) {
+	type longLine struct{ number, length int }
+	var found []longLine
+	for i, l := range co.CodeownersFileLines {
+		if length := utf8.RuneCountInString(l); length > maxLength {
+			found = append(found, longLine{number: i + 1, length: length})
+		}
+	}
+	slices.SortStableFunc(found, func(a, b longLine) int { return b.length - a.length })
+	for _, l := range found {
+		longLines = append(longLines, fmt.Sprintf("line %d: %d characters", l.number, l.length))
+	}
+	return
+}
+
+// Return the number of file pattern entries in all sections
+func (co *CodeownersFileAnatomy) EntryCount() (count int) {
+	for _, section := range co.Sections {
+		count += len(section.Entries)
+	}
+	return
+}
+
+// Role owner patterns that GitLab documents, which make every direct project member with that role an owner.
+// GitLab accepts both the singular and plural forms. Described here:
+// https://docs.gitlab.com/ee/user/project/codeowners/reference.html
+var RoleOwnerPatterns = []string{"@@developer", "@@developers", "@@maintainer", "@@maintainers", "@@owner", "@@owners"}
+
+// Split the owner portion of a CODEOWNERS line into its individual @user/@group, @@special and email patterns
 // Note: Owner patterns that don't contain '@' are ignored by GitLab. This behavior is described
 // here: https://docs.gitlab.com/ee/user/project/codeowners/reference.html#example-codeowners-file
-func splitOwnerPatterns(ownerPatterns string) (usersOrGroups []string, emails []string, ignored []string) {
+func splitOwnerPatterns(ownerPatterns string) (usersOrGroups []string, specialOwners []string, emails []string,
+	malformedEmails []string, ignored []string) {
 	for _, o := range strings.Fields(ownerPatterns) {
-		if strings.HasPrefix(o, "@") {
+		if strings.HasPrefix(o, "@@") {
+			// Ex: @@developer. These aren't usernames or group paths, so they must not be looked up as one.
+			specialOwners = append(specialOwners, o)
+		} else if strings.HasPrefix(o, "@") {
 			usersOrGroups = append(usersOrGroups, o)
 		} else if strings.Contains(o, "@") {
-			emails = append(emails, o)
+			if isValidEmail(o) {
+				emails = append(emails, o)
+			} else {
+				malformedEmails = append(malformedEmails, o)
+			}
 		} else {
 			ignored = append(ignored, o)
 		}
@@ -141,9 +576,21 @@ func splitOwnerPatterns(ownerPatterns string) (usersOrGroups []string, emails []
 	return
 }
 
+// Returns true if the owner pattern is a plain email address (ex: "alice@example.com"), as opposed to a typo
+// like "alice@" or "bob@@example.com". A display name or angle brackets (ex: "<alice@example.com>") are not
+// allowed either, since GitLab matches the owner pattern against the user's email verbatim.
+func isValidEmail(ownerPattern string) bool {
+	address, err := mail.ParseAddress(ownerPattern)
+	if err != nil {
+		slog.Debug("isValidEmail(): '" + ownerPattern + "' is not a valid email: " + err.Error())
+		return false
+	}
+	return address.Address == ownerPattern
+}
+
 // Split each CODEOWNERS line into its main parts, with a [section heading] or file pattern on the left, and
 // owner patterns on the right.
-func splitCodeownersLine(line string) (sectionHeading string, filePattern string, ownerPatterns string) {
+func SplitCodeownersLine(line string) (sectionHeading string, filePattern string, ownerPatterns string) {
 	line = strings.TrimSpace(line)
 	// Skip any blank/whitespace or comment lines
 	if line == "" || strings.HasPrefix(line, "#") {
@@ -155,10 +602,7 @@ func splitCodeownersLine(line string) (sectionHeading string, filePattern string
 	sectionHeadingEnded := false
 	// Find the split position within the line
 	for i, c := range line {
-		prevCharIsEscape := false
-		if i > 0 && line[i-1] == '\\' {
-			prevCharIsEscape = true
-		}
+		prevCharIsEscape := IsEscaped(line, i)
 		if i == 0 && c == '^' {
 			firstCharIsHat = true
 		}
@@ -198,3 +642,13 @@ func splitCodeownersLine(line string) (sectionHeading string, filePattern string
 	ownerPatterns = rightSide
 	return
 }
+
+// Return true if the character at position i of the line is escaped, i.e. it's preceded by an odd number of
+// backslashes. An even number means that the backslashes escape each other, ex: "tools\\ @owner".
+func IsEscaped(line string, i int) bool {
+	backslashes := 0
+	for j := i - 1; j >= 0 && line[j] == '\\'; j-- {
+		backslashes++
+	}
+	return backslashes%2 == 1
+}
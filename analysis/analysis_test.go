@@ -0,0 +1,262 @@
+package analysis
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseSectionHeading(t *testing.T) {
+	tests := []struct {
+		heading  string
+		name     string
+		optional bool
+		count    int
+	}{
+		{heading: "[Security]", name: "Security"},
+		{heading: "^[Opt]", name: "Opt", optional: true},
+		{heading: "[Name With Spaces][2]", name: "Name With Spaces", count: 2},
+		{heading: "^[Security][3]", name: "Security", optional: true, count: 3},
+		{heading: `[Weird\]Name]`, name: "Weird]Name"},
+		{heading: `^[Weird\]Name][2]`, name: "Weird]Name", optional: true, count: 2},
+		{heading: `[Ends With Backslash\\]`, name: `Ends With Backslash\\`},
+		{heading: "[Docs][-1]", name: "Docs"},
+		{heading: "[Docs][+2]", name: "Docs"},
+		{heading: "[Docs][two]", name: "Docs"},
+		{heading: "[Docs][2", name: "Docs"},
+		{heading: "[Docs][99999999999999999999]", name: "Docs"},
+		{heading: "[Docs", name: "Docs"},
+		{heading: `[Docs\]`, name: "Docs]"},
+		{heading: "^[", name: "", optional: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.heading, func(t *testing.T) {
+			section := parseSectionHeading(tt.heading)
+			if section.Heading != tt.heading {
+				t.Errorf("Heading = %q, want %q", section.Heading, tt.heading)
+			}
+			if section.Name != tt.name {
+				t.Errorf("Name = %q, want %q", section.Name, tt.name)
+			}
+			if section.Optional != tt.optional {
+				t.Errorf("Optional = %v, want %v", section.Optional, tt.optional)
+			}
+			if section.ApprovalCount != tt.count {
+				t.Errorf("ApprovalCount = %v, want %v", section.ApprovalCount, tt.count)
+			}
+		})
+	}
+}
+
+func TestSectionDefaultOwners(t *testing.T) {
+	tests := []struct {
+		line   string
+		name   string
+		owners []string
+	}{
+		{line: "[Name With Spaces][2] @a @b", name: "Name With Spaces", owners: []string{"@a", "@b"}},
+		{line: "^[Opt] @a", name: "Opt", owners: []string{"@a"}},
+		{line: `[Weird\]Name] @a`, name: "Weird]Name", owners: []string{"@a"}},
+		{line: "[No Owners][2]", name: "No Owners", owners: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			co := New("")
+			co.LoadContent(tt.line + "\n*.md\n")
+			co.Analyze()
+			if len(co.Sections) != 1 {
+				t.Fatalf("Sections = %v, want just the one section", co.Sections)
+			}
+			section := co.Sections[0]
+			if section.Name != tt.name {
+				t.Errorf("Name = %q, want %q", section.Name, tt.name)
+			}
+			if !slices.Equal(section.DefaultOwners, tt.owners) {
+				t.Errorf("DefaultOwners = %q, want %q", section.DefaultOwners, tt.owners)
+			}
+		})
+	}
+}
+
+func FuzzParseSectionHeading(f *testing.F) {
+	for _, heading := range []string{"[Security]", "^[Opt][2]", `[Weird\]Name]`, "[Docs][-1]", "[Docs", `\]]][[`} {
+		f.Add(heading)
+	}
+	f.Fuzz(func(t *testing.T, heading string) {
+		section := parseSectionHeading(heading)
+		if section.Heading != heading {
+			t.Errorf("Heading = %q, want %q", section.Heading, heading)
+		}
+		if section.Optional != strings.HasPrefix(heading, "^") {
+			t.Errorf("Optional = %v for heading %q", section.Optional, heading)
+		}
+		if section.ApprovalCount < 0 {
+			t.Errorf("ApprovalCount = %v for heading %q, want it to never be negative", section.ApprovalCount, heading)
+		}
+	})
+}
+
+func TestSplitCodeownersLine(t *testing.T) {
+	tests := []struct {
+		line           string
+		sectionHeading string
+		filePattern    string
+		ownerPatterns  string
+	}{
+		{line: ""},
+		{line: " \t "},
+		{line: "# A comment @owner"},
+		{line: "   # An indented comment"},
+		{line: "^[Optional Section] @owner", sectionHeading: "^[Optional Section]", ownerPatterns: "@owner"},
+		{line: `[Section with \] bracket][2] @owner`, sectionHeading: `[Section with \] bracket][2]`, ownerPatterns: "@owner"},
+		{line: "[Heading Only]", sectionHeading: "[Heading Only]"},
+		{line: "README.md\t@owner1\t@owner2", filePattern: "README.md", ownerPatterns: "@owner1\t@owner2"},
+		{line: "LICENSE.txt", filePattern: "LICENSE.txt"},
+		{line: "  LICENSE.txt  ", filePattern: "LICENSE.txt"},
+		{line: `docs/my\ file.md @owner`, filePattern: `docs/my\ file.md`, ownerPatterns: "@owner"},
+		{line: `docs/my\ file.md`, filePattern: `docs/my\ file.md`},
+		{line: `tools\\ @owner`, filePattern: `tools\\`, ownerPatterns: "@owner"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			sectionHeading, filePattern, ownerPatterns := SplitCodeownersLine(tt.line)
+			if sectionHeading != tt.sectionHeading {
+				t.Errorf("sectionHeading = %q, want %q", sectionHeading, tt.sectionHeading)
+			}
+			if filePattern != tt.filePattern {
+				t.Errorf("filePattern = %q, want %q", filePattern, tt.filePattern)
+			}
+			if ownerPatterns != tt.ownerPatterns {
+				t.Errorf("ownerPatterns = %q, want %q", ownerPatterns, tt.ownerPatterns)
+			}
+		})
+	}
+}
+
+func TestIsEscaped(t *testing.T) {
+	tests := []struct {
+		line string
+		i    int
+		want bool
+	}{
+		{`a b`, 1, false},
+		{`a\ b`, 2, true},
+		{`a\\ b`, 3, false},
+		{`a\\\ b`, 4, true},
+		{` b`, 0, false},
+	}
+	for _, tt := range tests {
+		if got := IsEscaped(tt.line, tt.i); got != tt.want {
+			t.Errorf("IsEscaped(%q, %d) = %v, want %v", tt.line, tt.i, got, tt.want)
+		}
+	}
+}
+
+func TestOwnerFilePatterns(t *testing.T) {
+	co := New("")
+	co.LoadContent(`*.md @alice
+[Replaced] @bob
+*.go @carol
+/docs/ @alice
+[Default Owners] @dave
+*.txt
+[No Entries] @erin
+`)
+	co.Analyze()
+	tests := []struct {
+		owner string
+		want  []string
+	}{
+		{"alice", []string{"*.md", "/docs/"}},
+		{"bob", []string{}}, // Every entry of its section has its own owners
+		{"carol", []string{"*.go"}},
+		{"dave", []string{"*.txt"}},
+		{"erin", []string{}}, // Its section has no entries
+	}
+	for _, tt := range tests {
+		if got := co.OwnerFilePatterns[tt.owner]; !slices.Equal(got, tt.want) {
+			t.Errorf("OwnerFilePatterns[%q] = %q, want %q", tt.owner, got, tt.want)
+		}
+	}
+}
+
+// Return an anatomy for a CODEOWNERS file with the content, in a new repo root
+func newCodeownersFile(tb testing.TB, content string) *CodeownersFileAnatomy {
+	tb.Helper()
+	repoRoot := tb.TempDir()
+	if err := os.WriteFile(filepath.Join(repoRoot, "CODEOWNERS"), []byte(content), 0644); err != nil {
+		tb.Fatal(err)
+	}
+	co := New(repoRoot)
+	co.CodeownersFilePath = "CODEOWNERS"
+	return co
+}
+
+func TestAnalyzeStreamingMatchesAnalyze(t *testing.T) {
+	content := "# Comment\r\n*.md @alice alice@example.com\r\n\n[Docs][2] @bob\n/docs/\n/docs/api/ @Carol @@developers\r" +
+		"^[Optional] @my-group/team\n*.go\t@dave\n\\#not-a-comment @erin\n"
+	retained := newCodeownersFile(t, content)
+	retained.Analyze()
+	streamed := New(retained.RepoRoot)
+	streamed.CodeownersFilePath = retained.CodeownersFilePath
+	if err := streamed.AnalyzeStreaming(); err != nil {
+		t.Fatalf("AnalyzeStreaming() error = %v", err)
+	}
+	// Only the retained parse keeps the raw lines
+	retained.CodeownersFileLines = nil
+	if !reflect.DeepEqual(streamed, retained) {
+		t.Errorf("AnalyzeStreaming() = %+v, want the same as Analyze() = %+v", streamed, retained)
+	}
+}
+
+func TestAnalyzeStreamingErrors(t *testing.T) {
+	co := New(t.TempDir())
+	co.CodeownersFilePath = "CODEOWNERS"
+	if err := co.AnalyzeStreaming(); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("AnalyzeStreaming() of a missing file error = %v, want %v", err, os.ErrNotExist)
+	}
+	co = newCodeownersFile(t, "*.md "+strings.Repeat("@a ", maxStreamingLineBytes/3+1)+"\n")
+	if err := co.AnalyzeStreaming(); err == nil {
+		t.Error("AnalyzeStreaming() of a line that's longer than the limit error = nil, want an error")
+	}
+}
+
+// Return a large generated CODEOWNERS file, with a section for each of 1,000 teams, of 100 entries each
+func generateCodeowners() string {
+	var content strings.Builder
+	for team := range 1000 {
+		fmt.Fprintf(&content, "[Team %d][2] @org/team-%d\n", team, team)
+		for entry := range 100 {
+			fmt.Fprintf(&content, "/services/team-%d/component-%d/ @org/team-%d @user-%d user-%d@example.com\n",
+				team, entry, team, entry, entry)
+		}
+	}
+	return content.String()
+}
+
+func BenchmarkAnalyzeStreaming(b *testing.B) {
+	co := newCodeownersFile(b, generateCodeowners())
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		if err := co.AnalyzeStreaming(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// For comparison with BenchmarkAnalyzeStreaming(), since this reads the whole file into memory first
+func BenchmarkAnalyze(b *testing.B) {
+	co := newCodeownersFile(b, generateCodeowners())
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		co.CodeownersFileLines = nil
+		co.Analyze()
+	}
+}
@@ -1,12 +1,62 @@
 package analysis
 
+// Everything that Analyze() parsed from the CODEOWNERS file. Printed by "analyze --format=json", so the json tags
+// are a schema for other tools: add fields freely, but don't rename or remove them.
 type CodeownersFileAnatomy struct {
-	CodeownersFilePath   string
-	Analyzed             bool
-	CodeownersFileLines  []string
-	SectionHeadings      []string
-	FilePatterns         []string
-	UserAndGroupPatterns []string
-	EmailPatterns        []string
-	IgnoredPatterns      []string
+	RepoRoot             string           `json:"repoRoot"`           // Root directory of the repo. Defaults to the current directory if empty.
+	CodeownersFilePath   string           `json:"codeownersFilePath"` // Relative to RepoRoot
+	IgnoredLocations     []string         `json:"ignoredLocations"`   // Other supported locations that also have a CODEOWNERS file, which GitLab ignores
+	ExtraLocations       []string         `json:"-"`                  // Locations to check after GitLab's 3 supported ones, relative to RepoRoot
+	Analyzed             bool             `json:"-"`
+	CodeownersFileLines  []string         `json:"-"`
+	SectionHeadings      []string         `json:"sectionHeadings"`
+	FilePatterns         []string         `json:"filePatterns"`
+	UserAndGroupPatterns []string         `json:"userAndGroupPatterns"`
+	WildcardOwners       []string         `json:"wildcardOwners"` // @user/@group patterns with wildcards (ex: @team-*), which GitLab doesn't expand
+	RoleOwners           []string         `json:"roleOwners"`     // @@role patterns that GitLab documents (ex: @@developer), which aren't users or groups
+	SpecialOwners        []string         `json:"specialOwners"`  // Other patterns that start with "@@" (ex: @@everyone), which GitLab doesn't document
+	EmailPatterns        []string         `json:"emailPatterns"`
+	MalformedEmails      []string         `json:"malformedEmails"` // Owner patterns that contain '@' (but don't start with it) and aren't valid emails
+	IgnoredPatterns      []string         `json:"ignoredPatterns"`
+	OwnerLines           map[string][]int `json:"ownerLines"`        // Line numbers where each owner pattern appears (without the "@" prefix, except for "@@" patterns)
+	FilePatternLines     map[string][]int `json:"filePatternLines"`  // Line numbers where each file pattern appears
+	Sections             []Section        `json:"sections"`          // In the order they appear. Entries before the first heading are in a section with no Name.
+	DuplicateSections    map[string][]int `json:"duplicateSections"` // Heading line numbers of each section name that is declared more than once
+	// The file patterns that each owner pattern applies to (keyed like OwnerLines), either as an entry's owner or as
+	// a section's default owner for its entries without owners. Empty for an owner that doesn't apply to any.
+	OwnerFilePatterns map[string][]string `json:"ownerFilePatterns"`
+}
+
+// A [section] of the CODEOWNERS file, ex: "^[Security][2] @security-team"
+type Section struct {
+	Name          string   `json:"name"`          // Without the brackets, ex: "Security"
+	Heading       string   `json:"heading"`       // The whole heading, ex: "^[Security][2]"
+	Line          int      `json:"line"`          // Line number of the heading
+	Optional      bool     `json:"optional"`      // Heading starts with "^"
+	ApprovalCount int      `json:"approvalCount"` // Number of required approvals, ex: 2 for "[Security][2]". 0 if not specified.
+	DefaultOwners []string `json:"defaultOwners"` // Owners on the heading line, which apply to entries that don't list their own
+	Entries       []Entry  `json:"entries"`
+}
+
+// A file pattern entry within a section, ex: "*.go @alice @go-team"
+type Entry struct {
+	FilePattern string   `json:"filePattern"`
+	Owners      []string `json:"owners"` // As written, ex: "@alice" or "alice@example.com"
+	Line        int      `json:"line"`
+}
+
+// Sets (string map of bool) used by Analyze() to collect unique patterns
+type patternSets struct {
+	sectionHeadings      map[string]bool
+	filePatterns         map[string]bool
+	userAndGroupPatterns map[string]bool
+	wildcardOwners       map[string]bool
+	roleOwners           map[string]bool
+	specialOwners        map[string]bool
+	emailPatterns        map[string]bool
+	malformedEmails      map[string]bool
+	ignoredPatterns      map[string]bool
+	ownerLines           map[string][]int
+	filePatternLines     map[string][]int
+	sections             *[]Section // Pointer, since the sets are passed by value
 }
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	neturl "net/url"
+	"reflect"
+	"strings"
+)
+
+// Shown in place of a secret's value. Empty secrets are shown as empty, so that it's clear whether they were set.
+const redacted = "[REDACTED]"
+
+// Log the effective configuration at debug level, after the env vars and flags have been merged and the token
+// has been resolved, so that a debug run documents its own inputs (ex: for a support question). Each setting is
+// logged by its env var name, or by its field name if it's only set by a flag. Fields tagged with secret:"true"
+// are redacted, as are the credentials in any URLs (ex: a proxy URL with a username and password in it).
+func logEffectiveConfig(subcommand string, eVars envVarArgs) {
+	if !slog.Default().Enabled(context.Background(), slog.LevelDebug) {
+		return
+	}
+	attrs := []any{slog.String("subcommand", subcommand), slog.String("version", buildVersion())}
+	// The GitLab args aren't read for a dry run or merge, and one of them is required if they are
+	if eVars.GitlabGraphqlUrl != "" {
+		attrs = append(attrs, configAttrs(reflect.ValueOf(eVars.gitlabArgs))...)
+	}
+	attrs = append(attrs, configAttrs(reflect.ValueOf(eVars.optionArgs))...)
+	slog.Debug("Effective configuration:", attrs...)
+}
+
+// Return a log attribute for each exported field of the args struct, with its secrets redacted
+func configAttrs(args reflect.Value) (attrs []any) {
+	for i := 0; i < args.NumField(); i++ {
+		field := args.Type().Field(i)
+		if !field.IsExported() {
+			continue // Derived from other fields, ex: extraHeaders
+		}
+		name := field.Name
+		if envName, _, _ := strings.Cut(field.Tag.Get("env"), ","); envName != "" { // ex: "CI_PROJECT_PATH,notEmpty"
+			name = envName
+		}
+		value := fmt.Sprint(args.Field(i).Interface())
+		switch {
+		case field.Tag.Get("secret") == "true" && value != "":
+			value = redacted
+		case args.Field(i).Kind() == reflect.String:
+			value = redactUrlCredentials(value)
+		}
+		attrs = append(attrs, slog.String(name, value))
+	}
+	return
+}
+
+// Return the value with its credentials redacted, if it's a URL with a username or password in it. A username
+// alone is redacted too, since some services take a token as the username. Otherwise, return the value as is.
+func redactUrlCredentials(value string) string {
+	u, err := neturl.Parse(value)
+	if err != nil || u.User == nil {
+		return value
+	}
+	u.User = neturl.User("REDACTED")
+	return u.String()
+}
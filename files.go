@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/bmatcuk/doublestar"
+	"gitlab.com/tedspinks/validate-codeowners/validate"
+)
+
+// Validate each CODEOWNERS file that matches the CODEOWNERS_FILES globs independently, ex: per-directory owner
+// files that are concatenated into the real CODEOWNERS file at build time. Each file's results are printed under
+// its path and merged into the report, where each finding names its file. GitLab's syntax check only applies to
+// the assembled CODEOWNERS file, so it's skipped for each file unless CODEOWNERS_FILES_SYNTAX_CHECK is set.
+func validateEachFile(cfg validate.Config, eVars envVarArgs) {
+	files, err := expandCodeownersFiles(cfg.RepoRoot, eVars.CodeownersFiles)
+	if err != nil {
+		fmt.Println("\nError " + err.Error())
+		os.Exit(validate.ExitCodeInternal)
+	}
+	fileStatuses := make([]string, len(files))
+	for i, file := range files {
+		fmt.Printf("\nValidating '%v' (%d of %d)\n", file, i+1, len(files))
+		fileCfg := cfg
+		fileCfg.CodeownersPath = file
+		fileCfg.SkipSyntaxCheck = cfg.SkipSyntaxCheck || !eVars.FilesSyntaxCheck
+		stopHandlingInterrupts := handleInterrupts()
+		fileReport, err := validate.Validate(fileCfg)
+		stopHandlingInterrupts()
+		stoppedEarly := err == nil && validationStoppedEarly(fileReport.Checks)
+		printNotes(fileReport.Notes)
+		printCheckResults(eVars, fileReport.Codeowners, fileReport.Checks, err == nil && !stoppedEarly)
+		if err != nil {
+			fmt.Println("\nError " + err.Error())
+			fileReport.Checks = append(fileReport.Checks, validate.CheckResult{Name: "Validation of " + file,
+				Status: validate.StatusFailed, ExitCode: validate.ExitCodeInternal, Error: err.Error()})
+		}
+		for _, check := range fileReport.Checks {
+			mergeCheckResult(check)
+		}
+		report.Summary.AddOwners(fileReport.Summary)
+		fileStatuses[i] = fmt.Sprintf("%v: %v", file, validate.StatusPassed)
+		if exitCode := fileReport.MostSevereExitCode(); exitCode != validate.ExitCodeSuccess {
+			fileStatuses[i] = fmt.Sprintf("%v: %v (exit code %d)", file, validate.StatusFailed, exitCode)
+		}
+	}
+	fmt.Println("\nResults by file:")
+	for _, status := range fileStatuses {
+		fmt.Println("     " + status)
+	}
+	if report.MostSevereExitCode() != validate.ExitCodeSuccess {
+		fmt.Println("\nSee failures noted above.")
+	}
+}
+
+// Expand the globs (relative to repoRoot) into the CODEOWNERS file paths that they match, relative to repoRoot.
+// Each glob must match at least one file.
+func expandCodeownersFiles(repoRoot string, globs []string) (files []string, err error) {
+	for _, glob := range globs {
+		glob = strings.TrimSpace(glob)
+		matches, globErr := doublestar.Glob(filepath.Join(repoRoot, glob))
+		if globErr != nil {
+			return nil, fmt.Errorf("cannot evaluate CODEOWNERS_FILES glob '%v': %w", glob, globErr)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no CODEOWNERS files found at '%v'", glob)
+		}
+		for _, match := range matches {
+			file, relErr := filepath.Rel(repoRoot, match)
+			if relErr != nil {
+				return nil, fmt.Errorf("cannot make '%v' relative to the repo root: %w", match, relErr)
+			}
+			if !slices.Contains(files, file) {
+				files = append(files, file)
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gitlab.com/tedspinks/validate-codeowners/analysis"
+	"gitlab.com/tedspinks/validate-codeowners/validate"
+)
+
+// Locate the CODEOWNERS file and fix it, for the --fix flag. Only a file in a working tree can be fixed.
+func runFix(cfg validate.Config) (err error) {
+	co, repoFiles, err := validate.Locate(cfg)
+	if err != nil {
+		return
+	}
+	if cfg.Content != nil || repoFiles != nil {
+		return errors.New("--fix can only rewrite a CODEOWNERS file in a working tree, not stdin, --content, or a bare repo")
+	}
+	graphqlServer, _, err := validate.SetupGitlabConnections(cfg)
+	if err != nil {
+		return
+	}
+	return fixCodeowners(graphqlServer, co)
+}
+
+// Rewrite the CODEOWNERS file in place to fix low-risk problems, and print a diff of the changed lines. Only
+// these problems are fixed, and entries are never reordered or removed:
+//   - trailing whitespace
+//   - mixed tabs and spaces between the owners (replaced by spaces to the same tab stop, to keep any alignment)
+//   - a missing "@" on an owner that is the username of an existing GitLab user
+//
+// The fixed content is loaded into co. The file is written before validation, which reads it again.
+func fixCodeowners(uChecker userExistenceChecker, co *analysis.CodeownersFileAnatomy) (err error) {
+	coPath := filepath.Join(co.RepoRoot, co.CodeownersFilePath)
+	rawContent, err := os.ReadFile(coPath)
+	if err != nil {
+		return fmt.Errorf("fixCodeowners() unable to read '%v': %w", coPath, err)
+	}
+	co.LoadContent(string(rawContent))
+	co.Analyze()
+	// Only owners that GitLab ignores (no "@") are candidates for a missing "@"
+	existingUsers, err := uChecker.CheckForGitLabUsers(co.IgnoredPatterns)
+	if err != nil {
+		return fmt.Errorf("fixCodeowners() errored in uChecker.CheckForGitLabUsers(): %w", err)
+	}
+	lines := co.CodeownersFileLines
+	fixedLines := make([]string, len(lines))
+	var diff []string
+	for i, line := range lines {
+		fixedLines[i] = fixCodeownersLine(line, existingUsers)
+		if fixedLines[i] != line {
+			diff = append(diff, fmt.Sprintf("line %d:", i+1),
+				"     - "+strconv.Quote(line),
+				"     + "+strconv.Quote(fixedLines[i]))
+		}
+	}
+	if len(diff) == 0 {
+		fmt.Printf("\nFixes for '%v': none needed\n", co.CodeownersFilePath)
+		return nil
+	}
+	// Keep the file's line endings, and its final newline (if it has one)
+	lineEnding := "\n"
+	if strings.Contains(string(rawContent), "\r\n") {
+		lineEnding = "\r\n"
+	}
+	fixedContent := strings.Join(fixedLines, lineEnding)
+	if strings.HasSuffix(string(rawContent), "\n") || strings.HasSuffix(string(rawContent), "\r") {
+		fixedContent += lineEnding
+	}
+	err = os.WriteFile(coPath, []byte(fixedContent), 0644)
+	if err != nil {
+		return fmt.Errorf("fixCodeowners() unable to write '%v': %w", coPath, err)
+	}
+	fmt.Printf("\nFixes applied to '%v':\n", co.CodeownersFilePath)
+	for _, d := range diff {
+		fmt.Println("     " + d)
+	}
+	co.LoadContent(fixedContent)
+	return nil
+}
+
+// Tab stops used when a mix of tabs and spaces is replaced by spaces, which is Git's default tab width
+const fixTabWidth = 8
+
+// Return the line with its low-risk problems fixed. Returns the line as it is if there's nothing to fix. Only the
+// whitespace spans that mix tabs and spaces are rewritten, so a separator of just spaces (or just tabs) that aligns
+// the owners is kept as it is.
+func fixCodeownersLine(line string, existingUsers []string) (fixedLine string) {
+	fixedLine = strings.TrimRight(line, " \t")
+	sectionHeading, filePattern, ownerPatterns := analysis.SplitCodeownersLine(fixedLine)
+	if ownerPatterns == "" {
+		return
+	}
+	// Everything after the [section heading] or file pattern, including its separator, is a whitespace span
+	// followed by an owner, for each owner
+	indent := fixedLine[:len(fixedLine)-len(strings.TrimLeft(fixedLine, " \t"))]
+	left := indent + sectionHeading + filePattern
+	var fixed strings.Builder
+	fixed.WriteString(left)
+	for rest := fixedLine[len(left):]; rest != ""; {
+		spanEnd := strings.IndexFunc(rest, func(c rune) bool { return c != ' ' && c != '\t' })
+		span := rest[:spanEnd]
+		if strings.Contains(span, " ") && strings.Contains(span, "\t") {
+			// Pad with spaces to the column the span ended at, to keep the owners aligned
+			span = strings.Repeat(" ", columnAfter(fixed.String()+span)-columnAfter(fixed.String()))
+		}
+		fixed.WriteString(span)
+		rest = rest[spanEnd:]
+		ownerEnd := strings.IndexAny(rest, " \t")
+		if ownerEnd < 0 {
+			ownerEnd = len(rest)
+		}
+		owner := rest[:ownerEnd]
+		if slices.Contains(existingUsers, owner) {
+			owner = "@" + owner
+		}
+		fixed.WriteString(owner)
+		rest = rest[ownerEnd:]
+	}
+	return fixed.String()
+}
+
+// Return the column that text written after s starts at, with a tab stop every fixTabWidth columns
+func columnAfter(s string) (column int) {
+	for _, c := range s {
+		if c == '\t' {
+			column += fixTabWidth - column%fixTabWidth
+		} else {
+			column++
+		}
+	}
+	return
+}
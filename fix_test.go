@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"gitlab.com/tedspinks/validate-codeowners/analysis"
+)
+
+// A userExistenceChecker whose only GitLab users are alice, bob, and dave
+type fakeUserChecker struct{}
+
+func (fakeUserChecker) CheckForGitLabUsers(usernames []string) (usernamesFound []string, err error) {
+	for _, username := range usernames {
+		if slices.Contains([]string{"alice", "bob", "dave"}, username) {
+			usernamesFound = append(usernamesFound, username)
+		}
+	}
+	return
+}
+
+// Each testdata/fix/<name>.before is fixed, and compared with testdata/fix/<name>.after
+func TestFixCodeowners(t *testing.T) {
+	befores, err := filepath.Glob("testdata/fix/*.before")
+	if err != nil || len(befores) == 0 {
+		t.Fatalf("no fixtures found in testdata/fix: %v", err)
+	}
+	for _, before := range befores {
+		name := strings.TrimSuffix(filepath.Base(before), ".before")
+		t.Run(name, func(t *testing.T) {
+			content, err := os.ReadFile(before)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := os.ReadFile(filepath.Join("testdata/fix", name+".after"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			repoRoot := t.TempDir()
+			coPath := filepath.Join(repoRoot, "CODEOWNERS")
+			if err := os.WriteFile(coPath, content, 0644); err != nil {
+				t.Fatal(err)
+			}
+			co := analysis.New(repoRoot)
+			co.CodeownersFilePath = "CODEOWNERS"
+			// Fixing it a second time shouldn't change it any further
+			for range 2 {
+				if err := fixCodeowners(fakeUserChecker{}, co); err != nil {
+					t.Fatalf("fixCodeowners() error = %v", err)
+				}
+				got, err := os.ReadFile(coPath)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(got) != string(want) {
+					t.Errorf("fixed CODEOWNERS = %q, want %q", got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+// This package reads files out of a Git repo's object database with the git CLI. It's used for bare (or
+// mirror) repos, which don't have a working tree to read files from, and to list the files that a branch changed.
+package gitfiles
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"strings"
+)
+
+// Return whether the repo at repoDir is a bare repo (i.e. it has no working tree)
+func IsBareRepo(repoDir string) (bool, error) {
+	output, err := runGit(repoDir, "rev-parse", "--is-bare-repository")
+	if err != nil {
+		return false, fmt.Errorf("IsBareRepo(): %w", err)
+	}
+	return strings.TrimSpace(output) == "true", nil
+}
+
+// Return the name of the branch that's checked out in the repo at repoDir. Returns an error if HEAD is detached,
+// since there's no branch to name.
+func CurrentBranch(repoDir string) (branch string, err error) {
+	output, err := runGit(repoDir, "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return "", fmt.Errorf("CurrentBranch(): %w", err)
+	}
+	branch = strings.TrimSpace(output)
+	if branch == "HEAD" {
+		return "", fmt.Errorf("CurrentBranch() the repo at '%v' has a detached HEAD, so it isn't on a branch", repoDir)
+	}
+	return branch, nil
+}
+
+// Return the paths of all the files in the repo at the specified ref (ex: a branch or tag name)
+func ListFiles(repoDir string, ref string) (files []string, err error) {
+	output, err := runGit(repoDir, "ls-tree", "-r", "--name-only", ref)
+	if err != nil {
+		return nil, fmt.Errorf("ListFiles() could not list the files at ref '%v': %w", ref, err)
+	}
+	for _, file := range strings.Split(output, "\n") {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+// Return the paths of the files that changed between the merge base of baseRef and ref, and ref, i.e. the files
+// that a merge request from ref into baseRef's branch would change. Deleted files are included.
+func ChangedFiles(repoDir string, baseRef string, ref string) (files []string, err error) {
+	output, err := runGit(repoDir, "diff", "--name-only", baseRef+"..."+ref)
+	if err != nil {
+		return nil, fmt.Errorf("ChangedFiles() could not diff '%v' against '%v': %w", ref, baseRef, err)
+	}
+	for _, file := range strings.Split(output, "\n") {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+// Return the content of the file at filePath, as of the specified ref (ex: a branch or tag name)
+func ReadFile(repoDir string, ref string, filePath string) (content string, err error) {
+	content, err = runGit(repoDir, "show", ref+":"+filePath)
+	if err != nil {
+		return "", fmt.Errorf("ReadFile() could not read '%v' at ref '%v': %w", filePath, ref, err)
+	}
+	return content, nil
+}
+
+// Run a git command against the repo at repoDir, and return its stdout
+func runGit(repoDir string, args ...string) (stdout string, err error) {
+	args = append([]string{"-C", repoDir}, args...)
+	slog.Debug("Running git command: git " + strings.Join(args, " "))
+	var outBuffer, errBuffer bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Stdout = &outBuffer
+	cmd.Stderr = &errBuffer
+	err = cmd.Run()
+	if err != nil {
+		return "", fmt.Errorf("'git %v' failed: %w: %v", strings.Join(args, " "), err, strings.TrimSpace(errBuffer.String()))
+	}
+	return outBuffer.String(), nil
+}
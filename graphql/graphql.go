@@ -2,6 +2,7 @@ package graphql
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,9 +11,13 @@ import (
 	"net/http"
 	neturl "net/url"
 	"strings"
-	"time"
+
+	"gitlab.com/tedspinks/validate-codeowners/transport"
 )
 
+// Max number of pages to read from a paged query, in case a misbehaving server always says there's a next page
+const maxPages = 1000
+
 // Return a list of users and associated emails that are direct members of the specified project. Only returns
 // users and emails that the server.GitlabToken identity has permission to see. userSource must be one of:
 // DIRECT, INVITED_GROUPS. For self-managed and dedicated SaaS instances of GitLab, I suggest using an admin token.
@@ -23,12 +28,14 @@ func (server Server) GetDirectUserMembers(projectFullPath string, userSource str
 	default:
 		panic("GetDirectUserMembers() userSource must be one of DIRECT, INVITED_GROUPS: '" + userSource + "'")
 	}
-	query := `query {project(fullPath: "` + projectFullPath +
-		`") {projectMembers(relations: ` + userSource + `) {pageInfo {endCursor startCursor hasNextPage} ` +
-		`nodes {id user {id username publicEmail emails {nodes {email}}}}}}}`
+	query := `query($fullPath: ID!, $relations: [ProjectMemberRelation!], $after: String) {
+		project(fullPath: $fullPath) {projectMembers(relations: $relations, after: $after) {
+			pageInfo {endCursor startCursor hasNextPage} nodes {id user {id username publicEmail emails {nodes {email}}}}}}}`
+	variables := map[string]any{"fullPath": projectFullPath, "relations": []string{userSource}, "after": nil}
+	seenCursors := map[string]bool{}
 	for {
-		_, jsonResponse, queryErr := server.RunGraphQlQuery(query)
-		if err != nil {
+		_, jsonResponse, queryErr := server.RunGraphQlQuery(query, variables)
+		if queryErr != nil {
 			err = fmt.Errorf("GetDirectUserMembers(): %w", queryErr)
 			return
 		}
@@ -40,6 +47,10 @@ func (server Server) GetDirectUserMembers(projectFullPath string, userSource str
 		}
 		// Append username and any emails to returns
 		for _, member := range queryResults.Data.Project.ProjectMembers.Nodes {
+			if member.User.Username == "" {
+				// A node that GitLab couldn't resolve, in a partial result
+				continue
+			}
 			usernamesFound = append(usernamesFound, member.User.Username)
 			publicEmail := member.User.PublicEmail
 			if publicEmail != "" {
@@ -53,11 +64,14 @@ func (server Server) GetDirectUserMembers(projectFullPath string, userSource str
 		}
 		// Check if the GraphQL results still have another page to process
 		if queryResults.Data.Project.ProjectMembers.PageInfo.HasNextPage {
-			// Update the query to give the next page of results
+			// Update the variables to give the next page of results
 			pageEndCursor := queryResults.Data.Project.ProjectMembers.PageInfo.EndCursor
-			query = `query {project(fullPath: "` + projectFullPath +
-				`") {projectMembers(relations: ` + userSource + ` after:"` + pageEndCursor +
-				`") {pageInfo {endCursor startCursor hasNextPage} nodes {id user {id username publicEmail emails {nodes {email}}}}}}}`
+			err = checkNextCursor(seenCursors, pageEndCursor)
+			if err != nil {
+				err = fmt.Errorf("GetDirectUserMembers(): %w", err)
+				return
+			}
+			variables["after"] = pageEndCursor
 		} else {
 			// Break if there are no more pages left
 			break
@@ -66,13 +80,164 @@ func (server Server) GetDirectUserMembers(projectFullPath string, userSource str
 	return
 }
 
+// Return which of the usernames belong to existing GitLab users that are visible to the server.GitlabToken
+// identity, regardless of whether they're members of any particular project.
+// Documentation: https://docs.gitlab.com/ee/api/graphql/reference/#queryusers
+func (server Server) CheckForGitLabUsers(usernames []string) (usernamesFound []string, err error) {
+	if len(usernames) == 0 {
+		return
+	}
+	query := `query($usernames: [String!], $after: String) {
+		users(usernames: $usernames, after: $after) {pageInfo {endCursor startCursor hasNextPage} nodes {id username}}}`
+	variables := map[string]any{"usernames": usernames, "after": nil}
+	seenCursors := map[string]bool{}
+	for {
+		_, jsonResponse, queryErr := server.RunGraphQlQuery(query, variables)
+		if queryErr != nil {
+			return nil, fmt.Errorf("CheckForGitLabUsers(): %w", queryErr)
+		}
+		var queryResults UserQueryResponse
+		err = json.Unmarshal(jsonResponse, &queryResults)
+		if err != nil {
+			return nil, fmt.Errorf("CheckForGitLabUsers() error encounted while unmarshaling '%v': %w", string(jsonResponse), err)
+		}
+		for _, user := range queryResults.Data.Users.Nodes {
+			if user.Username == "" {
+				// A node that GitLab couldn't resolve, in a partial result
+				continue
+			}
+			usernamesFound = append(usernamesFound, user.Username)
+		}
+		if !queryResults.Data.Users.PageInfo.HasNextPage {
+			break
+		}
+		err = checkNextCursor(seenCursors, queryResults.Data.Users.PageInfo.EndCursor)
+		if err != nil {
+			return nil, fmt.Errorf("CheckForGitLabUsers(): %w", err)
+		}
+		variables["after"] = queryResults.Data.Users.PageInfo.EndCursor
+	}
+	return
+}
+
+// Return an error if a paged query's next page would repeat a cursor that was already read, or would go past
+// maxPages. Otherwise remember the cursor. Guards against a server that keeps returning the same endCursor
+// with hasNextPage, which would otherwise page forever.
+func checkNextCursor(seenCursors map[string]bool, endCursor string) error {
+	if seenCursors[endCursor] {
+		return fmt.Errorf("the server returned the endCursor '%v' more than once, so stopping to avoid an infinite loop", endCursor)
+	}
+	if len(seenCursors)+1 >= maxPages {
+		return fmt.Errorf("stopped after reading %d pages, since the server still says there's a next page", maxPages)
+	}
+	seenCursors[endCursor] = true
+	return nil
+}
+
+// Look up a group by its full path (ex: my-group/my-subgroup). If the group doesn't exist, or isn't visible to
+// the server.GitlabToken identity, then the "group" return will be nil.
+// Documentation: https://docs.gitlab.com/ee/api/graphql/reference/#querygroup
+func (server Server) GetGroupByFullPath(fullPath string) (group *Group, err error) {
+	query := `query($fullPath: ID!) {group(fullPath: $fullPath) {id name path fullName fullPath visibility}}`
+	_, jsonResponse, err := server.RunGraphQlQuery(query, map[string]any{"fullPath": fullPath})
+	if err != nil {
+		return nil, fmt.Errorf("GetGroupByFullPath() failed: %w", err)
+	}
+	var queryResults GroupQueryResponse
+	err = json.Unmarshal(jsonResponse, &queryResults)
+	if err != nil {
+		return nil, fmt.Errorf("GetGroupByFullPath() error encounted while unmarshaling '%v': %w", string(jsonResponse), err)
+	}
+	return queryResults.Data.Group, nil
+}
+
+// Return the full paths of all the groups under the specified group, at any depth (ex: my-group/team-a and
+// my-group/team-a/backend). Returns nothing if the group doesn't exist, or isn't visible to the
+// server.GitlabToken identity.
+// Documentation: https://docs.gitlab.com/ee/api/graphql/reference/#groupdescendantgroups
+func (server Server) GetDescendantGroups(fullPath string) (descendants []string, err error) {
+	query := `query($fullPath: ID!, $after: String) {group(fullPath: $fullPath) {
+		descendantGroups(after: $after) {pageInfo {endCursor startCursor hasNextPage} nodes {fullPath}}}}`
+	variables := map[string]any{"fullPath": fullPath, "after": nil}
+	seenCursors := map[string]bool{}
+	for {
+		_, jsonResponse, queryErr := server.RunGraphQlQuery(query, variables)
+		if queryErr != nil {
+			return nil, fmt.Errorf("GetDescendantGroups(): %w", queryErr)
+		}
+		var queryResults DescendantGroupsQueryResponse
+		err = json.Unmarshal(jsonResponse, &queryResults)
+		if err != nil {
+			return nil, fmt.Errorf("GetDescendantGroups() error encounted while unmarshaling '%v': %w", string(jsonResponse), err)
+		}
+		if queryResults.Data.Group == nil {
+			return nil, nil
+		}
+		for _, group := range queryResults.Data.Group.DescendantGroups.Nodes {
+			if group.FullPath != "" {
+				descendants = append(descendants, group.FullPath)
+			}
+		}
+		pageInfo := queryResults.Data.Group.DescendantGroups.PageInfo
+		if !pageInfo.HasNextPage {
+			break
+		}
+		err = checkNextCursor(seenCursors, pageInfo.EndCursor)
+		if err != nil {
+			return nil, fmt.Errorf("GetDescendantGroups(): %w", err)
+		}
+		variables["after"] = pageInfo.EndCursor
+	}
+	return
+}
+
+// Return true if a group with the full path (ex: my-group/my-subgroup) exists and is visible to the
+// server.GitlabToken identity
+func (server Server) GroupExists(fullPath string) (exists bool, err error) {
+	group, err := server.GetGroupByFullPath(fullPath)
+	if err != nil {
+		return false, fmt.Errorf("GroupExists(): %w", err)
+	}
+	if group != nil {
+		slog.Debug(fmt.Sprintf("GroupExists(): group '%v' exists, with visibility '%v'", fullPath, group.Visibility))
+	}
+	return group != nil, nil
+}
+
+// Cheap query to check that the GraphQL API is reachable, and that GitLab accepts the server.GitlabToken.
+// Returns the username of the token's identity, or "" if GitLab treated the request as anonymous (ex: no token).
+// Returns transport.ErrTokenRejected (wrapped) if GitLab rejected the token.
+func (server Server) Ping() (username string, err error) {
+	query := `{__typename currentUser {username}}`
+	statusCode, jsonResponse, err := server.RunGraphQlQuery(query, nil)
+	if statusCode == http.StatusUnauthorized {
+		return "", fmt.Errorf("Ping() got status %d: %w", statusCode, transport.ErrTokenRejected)
+	}
+	if err != nil {
+		return "", fmt.Errorf("Ping() failed: %w", err)
+	}
+	var queryResults PingQueryResponse
+	err = json.Unmarshal(jsonResponse, &queryResults)
+	if err != nil {
+		return "", fmt.Errorf("Ping() error encounted while unmarshaling '%v': %w", string(jsonResponse), err)
+	}
+	if queryResults.Data.CurrentUser != nil {
+		username = queryResults.Data.CurrentUser.Username
+	}
+	return username, nil
+}
+
+// Returned (wrapped) by CheckCodeownersSyntax() when GitLab can't find the CODEOWNERS file on the branch
+var ErrCodeownersNotFound = errors.New("gitlab was unable to find the CODEOWNERS file")
+
 // Documentation: https://docs.gitlab.com/ee/api/graphql/reference/#repositoryvalidatecodeownerfile
 func (server Server) CheckCodeownersSyntax(codeownersPath string, projectPath string, branch string) (err error) {
 	// GraphQL search doesn't understand relative paths
 	codeownersPath = strings.TrimPrefix(codeownersPath, "./")
-	query := `query { project(fullPath: "` + projectPath + `") { repository { validateCodeownerFile(ref: "` + branch +
-		`", path: "` + codeownersPath + `") { total validationErrors { code lines }}}}}`
-	_, jsonResponse, err := server.RunGraphQlQuery(query)
+	query := `query($fullPath: ID!, $ref: String!, $path: String!) { project(fullPath: $fullPath) { repository {
+		validateCodeownerFile(ref: $ref, path: $path) { total validationErrors { code lines }}}}}`
+	variables := map[string]any{"fullPath": projectPath, "ref": branch, "path": codeownersPath}
+	_, jsonResponse, err := server.RunGraphQlQuery(query, variables)
 	if err != nil {
 		return fmt.Errorf("CheckCodeownersSyntax() failed: %w", err)
 	}
@@ -82,52 +247,89 @@ func (server Server) CheckCodeownersSyntax(codeownersPath string, projectPath st
 		return fmt.Errorf("CheckCodeownersSyntax() could not decode JSON response from GitLab: %w", err)
 	}
 	if queryResults.Data.Project.Repository.ValidateCodeownerFile == nil {
-		return fmt.Errorf("gitlab was unable to find the CODEOWNERS file in project '%v' on branch '%v' at the specified path: '%v'", projectPath, branch, codeownersPath)
+		return fmt.Errorf("%w in project '%v' on branch '%v' at the specified path: '%v'", ErrCodeownersNotFound, projectPath, branch, codeownersPath)
 	}
 	if queryResults.Data.Project.Repository.ValidateCodeownerFile.Total > 0 {
 		errorList := []error{}
 		for _, validationError := range queryResults.Data.Project.Repository.ValidateCodeownerFile.ValidationErrors {
-			errorMessage := validationError.Code
-			lines := strings.Trim(strings.Join(strings.Fields(fmt.Sprint(validationError.Lines)), ", "), "[]")
-			errorList = append(errorList, fmt.Errorf("validation error '%v' on lines: %v", errorMessage, lines))
+			errorList = append(errorList, &ValidationError{Code: validationError.Code, Lines: validationError.Lines})
 		}
 		err = errors.Join(errorList...)
 	}
 	return err
 }
 
+// Human-readable descriptions of the codes that validateCodeownerFile returns.
+// Source: https://gitlab.com/gitlab-org/gitlab/-/blob/master/ee/lib/gitlab/code_owners/error.rb
+var validationErrorDescriptions = map[string]string{
+	"invalid_section_format":       "the section heading is malformed, ex: a missing closing ']'",
+	"missing_section_name":         "the section heading has no name between the brackets",
+	"invalid_approval_requirement": "the section's approval count is not a positive number",
+	"invalid_section_owner_format": "the section's default owners are not formatted as @user, @group, or an email",
+	"missing_entry_owner":          "the entry has no owners, and its section has no default owners",
+	"invalid_entry_owner_format":   "the entry's owners are not formatted as @user, @group, or an email",
+}
+
+// Return a human-readable description of the validation error's code, or "" if the code isn't known
+func (e *ValidationError) Description() string {
+	return validationErrorDescriptions[e.Code]
+}
+
+// Describe the validation error, along with the CODEOWNERS line numbers that it applies to
+func (e *ValidationError) Error() string {
+	lines := strings.Trim(strings.Join(strings.Fields(fmt.Sprint(e.Lines)), ", "), "[]")
+	if description := e.Description(); description != "" {
+		return fmt.Sprintf("validation error '%v' (%v) on lines: %v", e.Code, description, lines)
+	}
+	return fmt.Sprintf("validation error '%v' on lines: %v", e.Code, lines)
+}
+
+// Send the request with the server's tokens, extra headers, and rate limit. See transport.DoWithFallbackToken().
+func (server Server) doWithFallbackToken(client Doer, req *http.Request) (*http.Response, error) {
+	return transport.DoWithFallbackToken(client, req, transport.Auth{Token: server.GitlabToken,
+		FallbackToken: server.FallbackToken, ExtraHeaders: server.ExtraHeaders, RateLimiter: server.RateLimiter})
+}
+
+// Return the server's HTTP client. Uses server.Client if it was set (ex: the shared, pooled client from
+// SetupGitlabConnections() or a mock), otherwise builds a client with the server's Timeout and Transport.
+func (server Server) httpClient() Doer {
+	if server.Client != nil {
+		return server.Client
+	}
+	return transport.NewClient(server.Transport, server.Timeout)
+}
+
 // Run the specified query string against the GitLab server's GraphQL API. Returns the API's response as
 // a raw (JSON) byte slice, so that the calling function can decode it to its expected type.
-func (server Server) RunGraphQlQuery(query string) (statusCode int, responseBody []byte, err error) {
+func (server Server) RunGraphQlQuery(query string, variables map[string]any) (statusCode int, responseBody []byte, err error) {
 	err = validateUrlWithPath(server.GraphQlUrl)
 	if err != nil {
 		return
 	}
-	client := &http.Client{
-		Timeout: time.Second * time.Duration(server.Timeout),
-	}
+	client := server.httpClient()
 	// Encode the qraphqlQuery object as a JSON byte slice
 	// We consolidate the query into 1 line so that syntax error messages with a position are easier to pinpoint
 	singleLineQuery := consolidateWhitespace(query)
-	slog.Debug("Setting up HTTP request for GraphQL query: " + singleLineQuery)
-	postData := qraphqlQuery{Query: singleLineQuery}
+	slog.Debug("Setting up HTTP request for GraphQL query: "+singleLineQuery, "variables", variables)
+	postData := qraphqlQuery{Query: singleLineQuery, Variables: variables}
 	postJson, err := json.Marshal(postData)
 	if err != nil {
 		err = fmt.Errorf("error trying to encode GraphQL query '%v' as JSON: '%w'", query, err)
 		return
 	}
 	// Setup the request
-	req, err := http.NewRequest("POST", server.GraphQlUrl, bytes.NewBuffer(postJson))
-	// req, err := http.NewRequest("POST", server.GraphQlUrl, strings.NewReader(string(postJson)))  // this also works
+	ctx := server.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", server.GraphQlUrl, bytes.NewBuffer(postJson))
 	if err != nil {
 		err = fmt.Errorf("error trying to create HTTP request to server '%v' with payload '%v': '%w'", server.GraphQlUrl, query, err)
 		return
 	}
 	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Authorization", "Bearer "+server.GitlabToken)
 	// Make the request
-	slog.Debug("Making HTTP request:", slog.Any("httpRequest", req))
-	res, err := client.Do(req)
+	res, err := server.doWithFallbackToken(client, req)
 	if err != nil {
 		err = fmt.Errorf("error making HTTP request to server '%v' with payload '%v': '%w'", server.GraphQlUrl, query, err)
 		return
@@ -140,11 +342,19 @@ func (server Server) RunGraphQlQuery(query string) (statusCode int, responseBody
 		err = fmt.Errorf("error reading response from server '%v' with GraphQL query '%v': '%w'", server.GraphQlUrl, query, err)
 		return
 	}
+	err = transport.CheckForNonJsonResponse(res, responseBody)
+	if err != nil {
+		return
+	}
 	slog.Debug("HTTP response received:", slog.Any(fmt.Sprint(res.StatusCode), responseBody))
 	if res.StatusCode != http.StatusOK {
 		err = fmt.Errorf("graphQL request to server '%v' with query '%v' returned status %d", server.GraphQlUrl, query, res.StatusCode)
 	}
 	err = getGraphQlErrors(responseBody)
+	if err != nil && server.AllowPartialResults && isPartialResult(responseBody) {
+		slog.Warn(fmt.Sprintf("GraphQL query '%v' returned partial results, so continuing with the data that was returned: %v", query, err))
+		err = nil
+	}
 	if err != nil {
 		err = fmt.Errorf("graphQL query '%v' received status code %d and errors: %w", query, res.StatusCode, err)
 		return
@@ -171,6 +381,22 @@ func getGraphQlErrors(jsonResponse []byte) (err error) {
 	return err
 }
 
+// Return true if the GraphQL response has data, and each of its errors is about a specific field (i.e. it has a
+// path), so that the rest of the data is still usable. Query-wide errors (ex: a syntax error) aren't partial.
+func isPartialResult(jsonResponse []byte) bool {
+	var response PartialResponse
+	err := json.Unmarshal(jsonResponse, &response)
+	if err != nil || len(response.Data) == 0 || string(response.Data) == "null" {
+		return false
+	}
+	for _, queryError := range response.Errors {
+		if len(queryError.Path) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
 // Return an error if the provided URL is not valid
 func validateUrlWithPath(url string) (err error) {
 	u, err := neturl.Parse(url)
@@ -0,0 +1,34 @@
+package graphql_test
+
+import (
+	"testing"
+
+	"gitlab.com/tedspinks/validate-codeowners/graphql"
+	"gitlab.com/tedspinks/validate-codeowners/rest"
+	"gitlab.com/tedspinks/validate-codeowners/testutil"
+)
+
+func TestGroupExists(t *testing.T) {
+	gitlab := &testutil.GitLab{Groups: []rest.GroupDetails{{Id: 10, Name: "team", FullPath: "my-group/team"}}}
+	gitlab.Start()
+	defer gitlab.Close()
+	server := graphql.Server{GraphQlUrl: gitlab.GraphQlUrl(), GitlabToken: "test-token", Timeout: 5}
+
+	tests := []struct {
+		fullPath string
+		want     bool
+	}{
+		{"my-group/team", true},
+		{"my-group/typo", false},
+		{"my-group", false},
+	}
+	for _, tt := range tests {
+		exists, err := server.GroupExists(tt.fullPath)
+		if err != nil {
+			t.Fatalf("GroupExists(%q) error = %v", tt.fullPath, err)
+		}
+		if exists != tt.want {
+			t.Errorf("GroupExists(%q) = %v, want %v", tt.fullPath, exists, tt.want)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package graphql_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"gitlab.com/tedspinks/validate-codeowners/graphql"
+	"gitlab.com/tedspinks/validate-codeowners/rest"
+	"gitlab.com/tedspinks/validate-codeowners/testutil"
+)
+
+func TestGetDirectUserMembers(t *testing.T) {
+	gitlab := &testutil.GitLab{
+		Projects: map[string]rest.Project{"my-group/my-project": {Id: 100, PathWithNamespace: "my-group/my-project",
+			SharedWithGroups: []rest.Group{{GroupId: 10, GroupFullPath: "my-group/team"}}}},
+		DirectMembers: map[string][]rest.Member{"my-group/my-project": {
+			{Id: 1, Username: "alice", PublicEmail: "alice@example.com"},
+			{Id: 2, Username: "bob", Email: "bob@example.com"},
+			{Id: 3, Username: "carol"},
+		}},
+		GroupMembers: map[int][]rest.Member{10: {{Id: 4, Username: "dave"}}},
+		PageSize:     1, // So that every member is on its own page
+	}
+	gitlab.Start()
+	defer gitlab.Close()
+	server := graphql.Server{GraphQlUrl: gitlab.GraphQlUrl(), GitlabToken: "test-token", Timeout: 5}
+
+	tests := []struct {
+		userSource    string
+		wantUsernames []string
+		wantEmails    []string
+	}{
+		{"DIRECT", []string{"alice", "bob", "carol"}, []string{"alice@example.com", "bob@example.com"}},
+		{"INVITED_GROUPS", []string{"dave"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.userSource, func(t *testing.T) {
+			usernames, emails, err := server.GetDirectUserMembers("my-group/my-project", tt.userSource)
+			if err != nil {
+				t.Fatalf("GetDirectUserMembers() error = %v", err)
+			}
+			if !slices.Equal(usernames, tt.wantUsernames) {
+				t.Errorf("GetDirectUserMembers() usernames = %v, want %v", usernames, tt.wantUsernames)
+			}
+			if !slices.Equal(emails, tt.wantEmails) {
+				t.Errorf("GetDirectUserMembers() emails = %v, want %v", emails, tt.wantEmails)
+			}
+		})
+	}
+}
+
+// Serve the fake GitLab, failing the test if any of the values were spliced into a GraphQL query's text instead of
+// being passed as variables, since a quote or backslash in them would corrupt the query
+func serveWithoutSplicedValues(t *testing.T, gitlab *testutil.GitLab, values ...string) (graphQlUrl string) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("unable to read the request body: %v", err)
+		}
+		var request struct {
+			Query string `json:"query"`
+		}
+		if err := json.Unmarshal(body, &request); err != nil {
+			t.Errorf("the request body isn't valid JSON: %v", err)
+		}
+		for _, value := range values {
+			if strings.Contains(request.Query, value) {
+				t.Errorf("%q was spliced into the query: %v", value, request.Query)
+			}
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		gitlab.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL + "/api/graphql"
+}
+
+func TestSpecialCharactersArePassedAsVariables(t *testing.T) {
+	projectPath := `my-group/o'brien "quoted" \project`
+	username := "first.last-name"
+	gitlab := &testutil.GitLab{
+		Projects:      map[string]rest.Project{projectPath: {Id: 100, PathWithNamespace: projectPath}},
+		DirectMembers: map[string][]rest.Member{projectPath: {{Id: 1, Username: username}}},
+		Users:         []rest.Member{{Id: 1, Username: username}},
+	}
+	server := graphql.Server{GraphQlUrl: serveWithoutSplicedValues(t, gitlab, projectPath, username),
+		GitlabToken: "test-token", Timeout: 5}
+
+	usernames, _, err := server.GetDirectUserMembers(projectPath, "DIRECT")
+	if err != nil {
+		t.Fatalf("GetDirectUserMembers() error = %v", err)
+	}
+	if !slices.Equal(usernames, []string{username}) {
+		t.Errorf("GetDirectUserMembers() usernames = %v, want [%v]", usernames, username)
+	}
+	usernames, err = server.CheckForGitLabUsers([]string{username, "not.a-user"})
+	if err != nil {
+		t.Fatalf("CheckForGitLabUsers() error = %v", err)
+	}
+	if !slices.Equal(usernames, []string{username}) {
+		t.Errorf("CheckForGitLabUsers() = %v, want [%v]", usernames, username)
+	}
+}
@@ -1,11 +1,35 @@
 package graphql
 
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"gitlab.com/tedspinks/validate-codeowners/ratelimit"
+	"gitlab.com/tedspinks/validate-codeowners/transport"
+)
+
+// Connection settings for GitLab's GraphQL API. The methods don't change the Server, and its optional RateLimiter
+// is safe to share, so one Server can be used by concurrent goroutines (ex: several validations).
 type Server struct {
-	GraphQlUrl  string // HTTPS URL for your GitLab instance's GraphQL API.
-	GitlabToken string // GitLab token for connecting to the GraphQL API (scope=read_api, role=Developer)
-	Timeout     int    // Timeout for GraphQL requests, in seconds
+	GraphQlUrl    string             // HTTPS URL for your GitLab instance's GraphQL API.
+	GitlabToken   string             // GitLab token for connecting to the GraphQL API (scope=read_api, role=Developer)
+	FallbackToken string             // Optional token to retry a request with, once, if GitLab rejects GitlabToken (401)
+	Timeout       int                // Timeout for GraphQL requests, in seconds
+	Transport     http.RoundTripper  // Optional HTTP transport (ex: for a proxy). Go's default transport is used if nil.
+	Client        Doer               // Optional HTTP client (ex: a mock for testing). Built from Timeout and Transport if nil.
+	RateLimiter   *ratelimit.Limiter // Optional client-side rate limit. No limit if nil.
+	ExtraHeaders  http.Header        // Optional headers to add to every request, ex: for a gateway. Never logged.
+	Context       context.Context    // Optional context for every request, ex: with a deadline for a whole phase. Never canceled if nil.
+	// Optional. If true, errors about specific fields (ex: one inaccessible member) are logged as a warning when
+	// the response still has data, instead of failing the whole query. The fields with errors are returned as null.
+	AllowPartialResults bool
 }
 
+// Sends an HTTP request and returns its response. Satisfied by *http.Client, so that a mock can be injected
+// into Server.Client to test error handling without a real server.
+type Doer = transport.Doer
+
 type ProjectMembersQueryResponse struct {
 	Data struct {
 		Project struct {
@@ -52,16 +76,50 @@ type ValidateCodeownersFile struct {
 	} `json:"validationErrors"`
 }
 
+// A CODEOWNERS syntax error that GitLab found with validateCodeownerFile
+type ValidationError struct {
+	Code  string
+	Lines []int
+}
+
 type GroupQueryResponse struct {
 	Data struct {
-		Group struct {
-			Id         string `json:"id"`
-			Name       string `json:"name"`
-			Path       string `json:"path"`
-			FullName   string `json:"fullName"`
-			FullPath   string `json:"fullPath"`
-			Visibility string `json:"visibility"`
-		} `json:"group"`
+		Group *Group `json:"group"` // null if the group doesn't exist, or isn't visible
+	} `json:"data"`
+}
+
+type Group struct {
+	Id         string `json:"id"`
+	Name       string `json:"name"`
+	Path       string `json:"path"`
+	FullName   string `json:"fullName"`
+	FullPath   string `json:"fullPath"`
+	Visibility string `json:"visibility"` // ex: "private", "internal", or "public"
+}
+
+type DescendantGroupsQueryResponse struct {
+	Data struct {
+		Group *struct {
+			DescendantGroups struct {
+				PageInfo struct {
+					EndCursor   string `json:"endCursor"`
+					StartCursor string `json:"startCursor"`
+					HasNextPage bool   `json:"hasNextPage"`
+				} `json:"pageInfo"`
+				Nodes []struct {
+					FullPath string `json:"fullPath"`
+				} `json:"nodes"`
+			} `json:"descendantGroups"`
+		} `json:"group"` // null if the group doesn't exist, or isn't visible
+	} `json:"data"`
+}
+
+type PingQueryResponse struct {
+	Data struct {
+		Typename    string `json:"__typename"`
+		CurrentUser *struct {
+			Username string `json:"username"`
+		} `json:"currentUser"` // null if the request was anonymous
 	} `json:"data"`
 }
 
@@ -89,6 +147,8 @@ type UserQueryResponse struct {
 
 type qraphqlQuery struct {
 	Query string `json:"query"`
+	// Values for the $variables declared in the query, so user input is never spliced into the query text
+	Variables map[string]any `json:"variables,omitempty"`
 }
 
 type QueryErrors struct {
@@ -100,5 +160,12 @@ type QueryErrors struct {
 			Line   int `json:"line"`
 			Column int `json:"column"`
 		} `json:"locations"`
+		Path []any `json:"path"` // The field with the error, ex: ["project", "projectMembers", "nodes", 3]. Empty for a query-wide error.
 	} `json:"errors"`
 }
+
+// A response with both data and errors, ex: when some of the requested fields couldn't be resolved
+type PartialResponse struct {
+	Data json.RawMessage `json:"data"`
+	QueryErrors
+}
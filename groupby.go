@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"gitlab.com/tedspinks/validate-codeowners/analysis"
+	"gitlab.com/tedspinks/validate-codeowners/validate"
+)
+
+// Print the results grouped by owner, for CODEOWNERS_OUTPUT_GROUP_BY=owner, so that all the problems with an
+// owner can be triaged together. Each owner is listed with the lines that reference it, followed by its findings
+// from every check. Findings that aren't about an owner (ex: file patterns) and errors are printed by check
+// afterwards, just like the default output.
+func printResultsByOwner(co *analysis.CodeownersFileAnatomy, checks []validate.CheckResult) {
+	var owners []string
+	ownerFindings := map[string][]string{} // Owner -> descriptions of its findings
+	ownerLines := map[string][]int{}
+	var otherResults []validate.CheckResult
+	for _, result := range checks {
+		otherResult := result
+		otherResult.Findings = nil
+		for _, finding := range result.Findings {
+			// A finding is about an owner if its value is one of the owners, in which case its lines are the owner's
+			if _, isOwner := co.OwnerLines[finding.Value]; !isOwner {
+				otherResult.Findings = append(otherResult.Findings, finding)
+				continue
+			}
+			owner := finding.Value
+			if _, found := ownerFindings[owner]; !found {
+				owners = append(owners, owner)
+				ownerLines[owner] = finding.Lines
+			}
+			description := fmt.Sprintf("%v (%v): %v", result.Name, result.Status, strings.TrimSuffix(result.Message, ":"))
+			if finding.Detail != "" {
+				description += ": " + finding.Detail
+			}
+			ownerFindings[owner] = append(ownerFindings[owner], description)
+		}
+		if result.Error != "" || len(otherResult.Findings) > 0 {
+			otherResults = append(otherResults, otherResult)
+		}
+	}
+	indent := "     "
+	if len(owners) > 0 {
+		fmt.Println("\nProblems by owner:")
+	}
+	slices.Sort(owners)
+	for _, owner := range owners {
+		displayOwner := owner
+		if slices.Contains(co.UserAndGroupPatterns, owner) || slices.Contains(co.WildcardOwners, owner) {
+			displayOwner = "@" + owner
+		}
+		fmt.Printf("%v%v on lines: %v\n", indent, displayOwner, validate.FormatLineNumbers(ownerLines[owner]))
+		for _, description := range ownerFindings[owner] {
+			fmt.Println(indent + indent + description)
+		}
+	}
+	for _, result := range otherResults {
+		printCheckResult(result)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+
+	"gitlab.com/tedspinks/validate-codeowners/validate"
+)
+
+// The check results of the validation that's in progress, so that they can be printed if it's interrupted
+var inProgress completedChecks
+
+// Check results that have been recorded so far. Safe to use from the signal handler's goroutine.
+type completedChecks struct {
+	mutex  sync.Mutex
+	checks []validate.CheckResult
+}
+
+// Remember a check's result. Use as validate.Config.OnResult.
+func (c *completedChecks) add(result validate.CheckResult) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.checks = append(c.checks, result)
+}
+
+// Until the returned stop function is called, an interrupt (ex: Ctrl-C) prints the checks that completed since
+// this was called, labeled as incomplete, and exits with ExitCodeInterrupted. Call stop before printing the
+// results, so that an interrupt while printing them doesn't print them twice.
+func handleInterrupts() (stop func()) {
+	inProgress.mutex.Lock()
+	inProgress.checks = nil
+	inProgress.mutex.Unlock()
+	interrupts := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(interrupts, os.Interrupt)
+	go func() {
+		select {
+		case <-interrupts:
+			printInterrupted()
+			os.Exit(validate.ExitCodeInterrupted)
+		case <-done:
+		}
+	}()
+	return func() {
+		signal.Stop(interrupts)
+		close(done)
+	}
+}
+
+// Print the checks that completed before the interrupt
+func printInterrupted() {
+	inProgress.mutex.Lock()
+	defer inProgress.mutex.Unlock()
+	fmt.Printf("\nInterrupted, so the results are incomplete. Checks that completed (%d):\n", len(inProgress.checks))
+	for _, result := range inProgress.checks {
+		printCheckResult(result)
+	}
+}
@@ -1,228 +1,667 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log/slog"
+	"net/http"
 	"os"
+	"path/filepath"
+	"runtime/debug"
 	"slices"
 	"strings"
+	"time"
 
-	"github.com/bmatcuk/doublestar" // because Glob() in "path/filepath" doesn't support "**"
 	"github.com/caarlos0/env/v11"
 	"gitlab.com/tedspinks/validate-codeowners/analysis"
+	"gitlab.com/tedspinks/validate-codeowners/gitfiles"
 	"gitlab.com/tedspinks/validate-codeowners/graphql"
-	"gitlab.com/tedspinks/validate-codeowners/rest"
+	"gitlab.com/tedspinks/validate-codeowners/transport"
+	"gitlab.com/tedspinks/validate-codeowners/validate"
 )
 
+// Subcommands. "check" is the default, so that invocations from before there were subcommands keep working.
+const (
+	cmdCheck   = "check"   // Validate the CODEOWNERS file
+	cmdAnalyze = "analyze" // Print what was parsed from the CODEOWNERS file, without any API calls (same as CODEOWNERS_DRY_RUN)
+	cmdFix     = "fix"     // Fix low-risk problems in the CODEOWNERS file in place, without validating it
+	cmdPing    = "ping"    // Check that GitLab's APIs are reachable and accept the token, without validating anything
+	cmdVersion = "version" // Print the version
+)
+
+var subcommands = []string{cmdCheck, cmdAnalyze, cmdFix, cmdPing, cmdVersion}
+
+// Version of the build, ex: go build -ldflags "-X main.version=1.2.3". If it's not set, then the module version
+// from the build info is used instead.
+var version = ""
+
 type envVarArgs struct {
-	ProjectPath       string `env:"CI_PROJECT_PATH,notEmpty"`
-	Branch            string `env:"CI_COMMIT_REF_NAME,notEmpty"`
-	GitlabGraphqlUrl  string `env:"CI_API_GRAPHQL_URL,notEmpty"`
-	GitlabRestUrl     string `env:"CI_API_V4_URL,notEmpty"`
-	GitlabToken       string `env:"GITLAB_TOKEN,notEmpty"`
-	GitlabTimeoutSecs int    `env:"GITLAB_TIMEOUT_SECS" envDefault:"30"`
-	Debug             bool   `env:"CODEOWNERS_DEBUG" envDefault:"false"`
+	gitlabArgs
+	optionArgs
+}
+
+// Args for connecting to GitLab, which are only required when the run makes API calls. Fields tagged with
+// secret:"true" are redacted from the effective configuration that's logged in debug mode.
+type gitlabArgs struct {
+	ProjectPath         string      `env:"CI_PROJECT_PATH,notEmpty"`
+	Branch              string      `env:"CI_COMMIT_REF_NAME,notEmpty"`
+	MergeRequestIid     int         `env:"CI_MERGE_REQUEST_IID" envDefault:"0"`
+	Author              string      `env:"GITLAB_USER_LOGIN" envDefault:""` // Used if the run isn't for a merge request
+	GitlabGraphqlUrl    string      `env:"CI_API_GRAPHQL_URL,notEmpty"`
+	GitlabRestUrl       string      `env:"CI_API_V4_URL,notEmpty"`
+	GitlabToken         string      `env:"GITLAB_TOKEN" envDefault:"" secret:"true"` // Required, unless GitlabTokenFile is set
+	GitlabTokenFile     string      `env:"GITLAB_TOKEN_FILE" envDefault:""`
+	GitlabNetrcFile     string      `env:"GITLAB_NETRC_FILE" envDefault:""`                   // Defaults to ~/.netrc
+	GitlabTokenFallback string      `env:"GITLAB_TOKEN_FALLBACK" envDefault:"" secret:"true"` // Retried once if GitlabToken gets a 401
+	GitlabTimeoutSecs   int         `env:"GITLAB_TIMEOUT_SECS" envDefault:"30"`
+	SyntaxTimeoutSecs   int         `env:"GITLAB_SYNTAX_TIMEOUT_SECS" envDefault:"0"`  // 0 to use GitlabTimeoutSecs
+	MembersTimeoutSecs  int         `env:"GITLAB_MEMBERS_TIMEOUT_SECS" envDefault:"0"` // 0 to use GitlabTimeoutSecs
+	GitlabProxyUrl      string      `env:"GITLAB_PROXY_URL" envDefault:""`
+	GitlabExtraHeaders  string      `env:"GITLAB_EXTRA_HEADERS" envDefault:"" secret:"true"` // Comma-separated Key:Value pairs
+	GitlabAllowPartial  bool        `env:"GITLAB_ALLOW_PARTIAL_RESULTS" envDefault:"false"`  // Warn about GraphQL errors on specific fields
+	GitlabRateLimit     float64     `env:"GITLAB_RATE_LIMIT" envDefault:"0"`                 // Requests per second, 0 for no limit
+	ApiBackend          string      `env:"CODEOWNERS_API_BACKEND" envDefault:"graphql"`      // "graphql" or "rest", for listing members
+	PushgatewayUrl      string      `env:"CODEOWNERS_PUSHGATEWAY_URL" envDefault:""`
+	extraHeaders        http.Header // Parsed from GitlabExtraHeaders
+}
+
+// Args that control how the CODEOWNERS file is analyzed and which checks are run
+type optionArgs struct {
+	Debug         bool     `env:"CODEOWNERS_DEBUG" envDefault:"false"`
+	DryRun        bool     `env:"CODEOWNERS_DRY_RUN" envDefault:"false"`
+	StreamParse   bool     `env:"CODEOWNERS_STREAM_PARSE" envDefault:"false"`
+	DenyOwners    []string `env:"CODEOWNERS_DENY_OWNERS" envDefault:""`
+	EmailDomains  []string `env:"CODEOWNERS_ALLOWED_EMAIL_DOMAINS" envDefault:""` // ex: "example.com,example.org"
+	ShowGlobs     string   `env:"CODEOWNERS_SHOW_GLOBS" envDefault:""`            // "text" or "json"
+	Format        string   `env:"CODEOWNERS_FORMAT" envDefault:"text"`            // "text" or "json", for a dry run. Also set by the --format flag.
+	OutputGroupBy string   `env:"CODEOWNERS_OUTPUT_GROUP_BY" envDefault:"check"`  // "check" or "owner"
+	RepoRoot      string   `env:"CODEOWNERS_REPO_ROOT" envDefault:"."`
+	Strict        bool     `env:"CODEOWNERS_STRICT" envDefault:"false"`
+	Timings       bool     `env:"CODEOWNERS_TIMINGS" envDefault:"false"`
+	GroupPrefix   string   `env:"CODEOWNERS_GROUP_PREFIX" envDefault:""`      // ex: "acme", so that @platform-team matches acme/platform-team
+	EmailStrict   bool     `env:"CODEOWNERS_EMAIL_STRICT" envDefault:"false"` // Fail on unknown emails, even with a non-admin token
+	FromStdin     bool     `env:"CODEOWNERS_FROM_STDIN" envDefault:"false"`   // Also set by the --stdin flag
+	Content       string   `env:"CODEOWNERS_CONTENT" envDefault:""`           // Also set by the --content flag
+	Fix           bool     // Only set by the --fix flag, since it rewrites a tracked file
+	// Locations to check for the CODEOWNERS file after GitLab's 3 supported ones, ex: "build/CODEOWNERS"
+	ExtraLocations []string `env:"CODEOWNERS_EXTRA_LOCATIONS" envDefault:""`
+	// Only set by the --target-project and --codeowners-file flags, to validate another project's checkout
+	TargetProject  string
+	CodeownersFile string
+	CodeownersPath string   // Derived from --codeowners-file, relative to RepoRoot
+	SkipSyntax     bool     `env:"CODEOWNERS_SKIP_SYNTAX_CHECK" envDefault:"false"`
+	JsonReport     string   `env:"CODEOWNERS_JSON_REPORT" envDefault:""`
+	MergeReports   []string `env:"CODEOWNERS_MERGE_REPORTS" envDefault:""`
+	// URL to POST the JSON report to after the run, ex: for a dashboard or chat integration
+	WebhookUrl     string      `env:"CODEOWNERS_WEBHOOK_URL" envDefault:"" secret:"true"`     // Often has a secret in its path
+	WebhookHeaders string      `env:"CODEOWNERS_WEBHOOK_HEADERS" envDefault:"" secret:"true"` // Comma-separated Key:Value pairs
+	webhookHeaders http.Header // Parsed from WebhookHeaders
+	// Built from GitlabProxyUrl, and shared by every request (to GitLab, the webhook, and the pushgateway), so that
+	// they all go through the same proxy
+	httpTransport http.RoundTripper
+	// Globs of CODEOWNERS files (relative to RepoRoot) to validate independently, ex: "**/CODEOWNERS.part"
+	CodeownersFiles  []string `env:"CODEOWNERS_FILES" envDefault:""`
+	FilesSyntaxCheck bool     `env:"CODEOWNERS_FILES_SYNTAX_CHECK" envDefault:"false"` // Also run GitLab's syntax check on each file
+	// Path to write a report of the effective owners of each file pattern
+	OwnershipReport string `env:"CODEOWNERS_OWNERSHIP_REPORT" envDefault:""`
+	// Path to a list of file patterns (one per line) to skip in the file pattern check
+	FilePatternIgnore string `env:"CODEOWNERS_FILE_PATTERN_IGNORE" envDefault:""`
+	// Fail file patterns that only match on a case-insensitive file system (ex: macOS, Windows)
+	CaseSensitiveGlob bool `env:"CODEOWNERS_CASE_SENSITIVE_GLOB" envDefault:"false"`
+	// Don't count the CODEOWNERS file itself as a file pattern match, ex: for "docs/" with only docs/CODEOWNERS
+	ExcludeSelfMatch bool `env:"CODEOWNERS_EXCLUDE_SELF_MATCH" envDefault:"false"`
+	// List the working tree's files once, and match the file patterns against the list instead of the file system
+	MatchInMemory bool `env:"CODEOWNERS_MATCH_IN_MEMORY" envDefault:"false"`
+	// Give up on the file pattern check after this many seconds, ex: for a huge repo on a slow file system
+	GlobTimeoutSecs int `env:"CODEOWNERS_GLOB_TIMEOUT_SECS" envDefault:"0"` // 0 to use GitlabTimeoutSecs
+	// Only check the file patterns that match files changed since this ref, ex: $CI_MERGE_REQUEST_DIFF_BASE_SHA
+	DiffBase string `env:"CODEOWNERS_DIFF_BASE" envDefault:""`
+	// Print how many files each file pattern matches, and warn about patterns that match more files than the limit
+	ReportMatchCounts bool `env:"CODEOWNERS_REPORT_MATCH_COUNTS" envDefault:"false"`
+	BroadPatternLimit int  `env:"CODEOWNERS_BROAD_PATTERN_LIMIT" envDefault:"0"` // 0 to skip the check
+	// Report files that aren't owned by any file pattern, except for the paths in the ignore list (if set)
+	ReportUnowned bool   `env:"CODEOWNERS_REPORT_UNOWNED" envDefault:"false"`
+	UnownedIgnore string `env:"CODEOWNERS_UNOWNED_IGNORE" envDefault:""`
+	// Optional checks
+	CheckApprovalSetting bool `env:"CODEOWNERS_CHECK_APPROVAL_SETTING" envDefault:"false"`
+	CheckWhitespace      bool `env:"CODEOWNERS_CHECK_WHITESPACE" envDefault:"false"`
+	CheckSeparator       bool `env:"CODEOWNERS_CHECK_SEPARATOR" envDefault:"false"`
+	CheckOwnerCasing     bool `env:"CODEOWNERS_CHECK_OWNER_CASING" envDefault:"false"`
+	CheckRedundantOwners bool `env:"CODEOWNERS_CHECK_REDUNDANT_OWNERS" envDefault:"false"`
+	CheckUnusedOwners    bool `env:"CODEOWNERS_CHECK_UNUSED_OWNERS" envDefault:"false"`
+	CheckBotOwners       bool `env:"CODEOWNERS_CHECK_BOT_OWNERS" envDefault:"false"`
+	// GitLab's usernames for the bot users of project and group access tokens, ex: project_123_bot_1a2b3c
+	BotOwnerPattern       string `env:"CODEOWNERS_BOT_OWNER_PATTERN" envDefault:"^(project|group)_\\d+_bot(_[0-9a-f]+)?$"`
+	CheckApproverCapacity bool   `env:"CODEOWNERS_CHECK_APPROVER_CAPACITY" envDefault:"false"`
+	CheckInvitedAccess    bool   `env:"CODEOWNERS_CHECK_INVITED_ACCESS" envDefault:"false"`
+	CheckGroupVisibility  bool   `env:"CODEOWNERS_CHECK_GROUP_VISIBILITY" envDefault:"false"`
+	RequiredParentGroup   string `env:"CODEOWNERS_REQUIRED_PARENT_GROUP" envDefault:""` // ex: "acme/approvers"
+	ResolveSubgroups      bool   `env:"CODEOWNERS_RESOLVE_SUBGROUPS" envDefault:"false"`
+	CheckAuthorOwner      bool   `env:"CODEOWNERS_CHECK_AUTHOR_OWNER" envDefault:"false"`
+	MaxLineLength         int    `env:"CODEOWNERS_MAX_LINE_LENGTH" envDefault:"0"` // 0 to skip the check
+	MaxEntries            int    `env:"CODEOWNERS_MAX_ENTRIES" envDefault:"0"`     // 0 to skip the check
+	FailIfEmpty           bool   `env:"CODEOWNERS_FAIL_IF_EMPTY" envDefault:"false"`
 }
 
 func main() {
+	subcommand, flagArgs, err := parseSubcommand(os.Args[1:])
+	if err != nil {
+		fmt.Println("\nError " + err.Error())
+		os.Exit(validate.ExitCodeInternal)
+	}
+	if subcommand == cmdVersion {
+		fmt.Println(buildVersion())
+		return
+	}
 	// Get args from env vars
 	eVars := envVarArgs{}
-	getEnvVerArgs(&eVars)
+	getEnvVerArgs(&eVars, subcommand, flagArgs)
 	// Prep
 	setLogLevel(eVars.Debug)
-	graphqlServer, restServer := setupGitlabConnections(eVars)
-	hasFailures := false
-	// Make sure codeowners syntax is valid before trying to analyze it
-	checkSyntax(graphqlServer, analysis.Co.CodeownersFilePath, eVars.ProjectPath, eVars.Branch)
-	// Analyze codeowners file structure
-	analysis.Co.Analyze()
-	if !checkAndPrintResults("Malformed users and groups check", nil, analysis.Co.IgnoredPatterns, "Users or groups that do not start with '@':") {
-		hasFailures = true
-	}
-	// Check owners
-	ugList := analysis.Co.UserAndGroupPatterns
-	eList := analysis.Co.EmailPatterns
-	userAndGroupLeftovers, emailLeftovers, err := checkOwners(graphqlServer, restServer, eVars.ProjectPath, ugList, eList)
-	if !checkAndPrintResults("Direct user and group membership check", err, userAndGroupLeftovers, "Unable to find:") {
-		hasFailures = true
-	}
-	if !checkAndPrintResults("Direct user email membership check", err, emailLeftovers, "Unable to find:") {
-		hasFailures = true
-	}
-	// Check file patterns
-	badFilePatterns, err := checkFilePatterns(analysis.Co.FilePatterns)
-	if !checkAndPrintResults("File pattern check", err, badFilePatterns, "Unable to find:") {
-		hasFailures = true
-	}
-	// Exit
-	if hasFailures {
+	logEffectiveConfig(subcommand, eVars)
+	showTimings = eVars.Timings
+	runStart = time.Now()
+	if subcommand == cmdPing {
+		runPing(newConfig(eVars))
+	}
+	if len(eVars.MergeReports) > 0 {
+		mergeReports(eVars.MergeReports)
+		exitWithReport(eVars)
+	}
+	cfg := newConfig(eVars)
+	cfg.OnResult = inProgress.add
+	if eVars.FromStdin {
+		content, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Println("\nError unable to read the CODEOWNERS content from stdin: " + err.Error())
+			os.Exit(validate.ExitCodeInternal)
+		}
+		cfg.Content = content
+	} else if eVars.Content != "" {
+		cfg.Content = []byte(eVars.Content)
+		cfg.ContentSource = "--content"
+	}
+	if len(eVars.CodeownersFiles) > 0 {
+		validateEachFile(cfg, eVars)
+		exitWithReport(eVars)
+	}
+	if eVars.DryRun {
+		co, _, err := validate.Locate(cfg)
+		if err == nil {
+			err = validate.AnalyzeCodeowners(cfg, co)
+		}
+		if err == nil && cfg.OwnershipReport != "" {
+			err = validate.WriteOwnershipReport(cfg.OwnershipReport, co.Sections)
+		}
+		if err != nil {
+			fmt.Println("\nError " + err.Error())
+			os.Exit(validate.ExitCodeInternal)
+		}
+		if eVars.Format == "json" {
+			printAnatomyJson(co)
+			return
+		}
+		printDryRun(co)
+		printGlobTranslations(eVars.ShowGlobs, eVars.RepoRoot, co.FilePatterns)
+		return
+	}
+	// Fix low-risk problems in the CODEOWNERS file before checking it
+	if eVars.Fix {
+		err := runFix(cfg)
+		if err != nil {
+			fmt.Println("\nError " + err.Error())
+			os.Exit(validate.ExitCodeInternal)
+		}
+		if subcommand == cmdFix {
+			return
+		}
+	}
+	stopHandlingInterrupts := handleInterrupts()
+	report, err = validate.Validate(cfg)
+	stopHandlingInterrupts()
+	stoppedEarly := err == nil && validationStoppedEarly(report.Checks)
+	printNotes(report.Notes)
+	printCheckResults(eVars, report.Codeowners, report.Checks, err == nil && !stoppedEarly)
+	if err != nil {
+		exitWithError(eVars, err)
+	}
+	// Exit with the most severe failure's exit code
+	if report.ExitCode != validate.ExitCodeSuccess && !stoppedEarly {
 		fmt.Println("\nSee failures noted above.")
-		os.Exit(1)
+	}
+	if eVars.PushgatewayUrl != "" && !stoppedEarly {
+		err = pushMetrics(eVars.PushgatewayUrl, eVars.ProjectPath, eVars.httpTransport, eVars.GitlabTimeoutSecs, report.Codeowners)
+		if err != nil {
+			// Metrics are nice to have, so don't fail the run over them
+			fmt.Println("\nWarning " + err.Error())
+		}
+	}
+	exitWithReport(eVars)
+}
+
+// Print the results of each check, either in the order that they ran, or grouped by owner if requested and
+// allowGroupBy is true (ex: it's false when validation stopped early, so there isn't much to group). co is the
+// CODEOWNERS file that was validated, or nil if validation errored before it was located.
+func printCheckResults(eVars envVarArgs, co *analysis.CodeownersFileAnatomy, checks []validate.CheckResult, allowGroupBy bool) {
+	if co == nil {
+		co = analysis.New(eVars.RepoRoot)
+	}
+	if eVars.OutputGroupBy == "owner" && allowGroupBy {
+		printGlobTranslations(eVars.ShowGlobs, eVars.RepoRoot, co.FilePatterns)
+		printResultsByOwner(co, checks)
+		return
+	}
+	for _, result := range checks {
+		switch result.Name {
+		case "Syntax check":
+			printSyntaxCheckResult(co, result)
+		case "File pattern check":
+			printGlobTranslations(eVars.ShowGlobs, eVars.RepoRoot, co.FilePatterns)
+			printCheckResult(result)
+		default:
+			printCheckResult(result)
+		}
+	}
+}
+
+// Print the informational notes about the run, before the check results that they apply to
+func printNotes(notes []string) {
+	for _, note := range notes {
+		fmt.Println("\nNote: " + note)
 	}
 }
 
-// Read in the program args from environment variables. Stop the program if there are any errors.
-func getEnvVerArgs(eVars *envVarArgs) {
+// Return true if validation stopped at a failed token access or syntax check, which is the only failure to see
+// in that case
+func validationStoppedEarly(checks []validate.CheckResult) bool {
+	lastCheck := checks[len(checks)-1]
+	return lastCheck.Status == validate.StatusFailed && slices.Contains([]string{"Token access check", "Syntax check"}, lastCheck.Name)
+}
+
+// Build the validate package's config from the env var (and flag) args
+func newConfig(eVars envVarArgs) validate.Config {
+	return validate.Config{
+		ProjectPath:           eVars.ProjectPath,
+		Branch:                eVars.Branch,
+		MergeRequestIid:       eVars.MergeRequestIid,
+		Author:                eVars.Author,
+		GitlabGraphqlUrl:      eVars.GitlabGraphqlUrl,
+		GitlabRestUrl:         eVars.GitlabRestUrl,
+		GitlabToken:           eVars.GitlabToken,
+		GitlabTokenFallback:   eVars.GitlabTokenFallback,
+		GitlabTimeout:         eVars.GitlabTimeoutSecs,
+		SyntaxTimeout:         eVars.SyntaxTimeoutSecs,
+		MembersTimeout:        eVars.MembersTimeoutSecs,
+		GitlabProxyUrl:        eVars.GitlabProxyUrl,
+		GitlabExtraHeaders:    eVars.extraHeaders,
+		GitlabTransport:       eVars.httpTransport,
+		AllowPartialResults:   eVars.GitlabAllowPartial,
+		GitlabRateLimit:       eVars.GitlabRateLimit,
+		ApiBackend:            eVars.ApiBackend,
+		RepoRoot:              eVars.RepoRoot,
+		ExtraLocations:        eVars.ExtraLocations,
+		CodeownersPath:        eVars.CodeownersPath,
+		StreamParse:           eVars.StreamParse,
+		Strict:                eVars.Strict,
+		SkipSyntaxCheck:       eVars.SkipSyntax,
+		GroupPrefix:           eVars.GroupPrefix,
+		EmailStrict:           eVars.EmailStrict,
+		DenyOwners:            eVars.DenyOwners,
+		AllowedEmailDomains:   eVars.EmailDomains,
+		OwnershipReport:       eVars.OwnershipReport,
+		FilePatternIgnore:     eVars.FilePatternIgnore,
+		CaseSensitiveGlob:     eVars.CaseSensitiveGlob,
+		ExcludeSelfMatch:      eVars.ExcludeSelfMatch,
+		GlobTimeout:           eVars.GlobTimeoutSecs,
+		MatchInMemory:         eVars.MatchInMemory,
+		DiffBase:              eVars.DiffBase,
+		ReportMatchCounts:     eVars.ReportMatchCounts,
+		BroadPatternLimit:     eVars.BroadPatternLimit,
+		ReportUnowned:         eVars.ReportUnowned,
+		UnownedIgnore:         eVars.UnownedIgnore,
+		CheckApprovalSetting:  eVars.CheckApprovalSetting,
+		CheckWhitespace:       eVars.CheckWhitespace,
+		CheckSeparator:        eVars.CheckSeparator,
+		CheckOwnerCasing:      eVars.CheckOwnerCasing,
+		CheckRedundantOwners:  eVars.CheckRedundantOwners,
+		CheckUnusedOwners:     eVars.CheckUnusedOwners,
+		CheckBotOwners:        eVars.CheckBotOwners,
+		BotOwnerPattern:       eVars.BotOwnerPattern,
+		CheckApproverCapacity: eVars.CheckApproverCapacity,
+		CheckInvitedAccess:    eVars.CheckInvitedAccess,
+		CheckGroupVisibility:  eVars.CheckGroupVisibility,
+		RequiredParentGroup:   eVars.RequiredParentGroup,
+		ResolveSubgroups:      eVars.ResolveSubgroups,
+		CheckAuthorOwner:      eVars.CheckAuthorOwner,
+		MaxLineLength:         eVars.MaxLineLength,
+		MaxEntries:            eVars.MaxEntries,
+		FailIfEmpty:           eVars.FailIfEmpty,
+	}
+}
+
+// Split the command line args into the subcommand and its flags. The subcommand defaults to "check" if the
+// first arg isn't a subcommand, ex: no args at all, or just flags.
+func parseSubcommand(args []string) (subcommand string, flagArgs []string, err error) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return cmdCheck, args, nil
+	}
+	if !slices.Contains(subcommands, args[0]) {
+		return "", nil, fmt.Errorf("unknown subcommand '%v', must be one of %v", args[0], strings.Join(subcommands, ", "))
+	}
+	return args[0], args[1:], nil
+}
+
+// Return the version of the build, or "(devel)" if it's unknown, ex: for go run
+func buildVersion() string {
+	if version != "" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "(devel)"
+}
+
+// Read in the program args from environment variables and the subcommand's flags. Stop the program if there are
+// any errors. The GitLab connection args are skipped for a dry run or merge, since those don't make any API calls,
+// but ping always needs them.
+func getEnvVerArgs(eVars *envVarArgs, subcommand string, flagArgs []string) {
 	opts := env.Options{RequiredIfNoDef: true}
-	err := env.ParseWithOptions(eVars, opts)
+	err := env.ParseWithOptions(&eVars.optionArgs, opts)
+	// Command line flags override their env vars
+	flag.BoolVar(&eVars.FromStdin, "stdin", eVars.FromStdin, "Read the CODEOWNERS content from stdin (same as CODEOWNERS_FROM_STDIN)")
+	flag.StringVar(&eVars.Content, "content", eVars.Content, "The CODEOWNERS content itself, ex: \"$(cat CODEOWNERS)\" (same as CODEOWNERS_CONTENT)")
+	flag.BoolVar(&eVars.Fix, "fix", false, "Rewrite the CODEOWNERS file in place to fix low-risk problems, and print a diff")
+	flag.StringVar(&eVars.Format, "format", eVars.Format, "Output format of the analyze subcommand, text or json (same as CODEOWNERS_FORMAT)")
+	flag.StringVar(&eVars.TargetProject, "target-project", "", "Path of the project to validate, instead of CI_PROJECT_PATH (requires --codeowners-file)")
+	flag.StringVar(&eVars.CodeownersFile, "codeowners-file", "", "Path of the target project's local CODEOWNERS file (requires --target-project)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %v [%v] [flags]\n", filepath.Base(os.Args[0]), strings.Join(subcommands, "|"))
+		flag.PrintDefaults()
+	}
+	flag.CommandLine.Parse(flagArgs) // Exits on a bad flag, since the flag set uses flag.ExitOnError
+	switch subcommand {
+	case cmdAnalyze:
+		eVars.DryRun = true
+	case cmdFix:
+		eVars.Fix = true
+	}
+	if err == nil && (subcommand == cmdPing || !eVars.DryRun && len(eVars.MergeReports) == 0) {
+		err = env.ParseWithOptions(&eVars.gitlabArgs, opts)
+		if err == nil {
+			err = resolveGitlabToken(&eVars.gitlabArgs)
+		}
+		if err == nil {
+			eVars.extraHeaders, err = transport.ParseHeaders(eVars.GitlabExtraHeaders)
+			if err != nil {
+				err = fmt.Errorf("GITLAB_EXTRA_HEADERS: %w", err)
+			}
+		}
+	}
+	if err == nil {
+		eVars.webhookHeaders, err = transport.ParseWebhookHeaders(eVars.WebhookHeaders)
+		if err != nil {
+			err = fmt.Errorf("CODEOWNERS_WEBHOOK_HEADERS: %w", err)
+		}
+	}
+	if err == nil {
+		eVars.httpTransport, err = transport.New(eVars.GitlabProxyUrl)
+		if err != nil {
+			err = fmt.Errorf("GITLAB_PROXY_URL: %w", err)
+		}
+	}
+	if err == nil {
+		err = applyTargetProject(eVars)
+	}
+	if err == nil {
+		err = validateRepoRoot(eVars.RepoRoot)
+	}
+	if err == nil {
+		eVars.ExtraLocations, err = cleanExtraLocations(eVars.ExtraLocations)
+	}
+	if err == nil && eVars.ApiBackend != "" && !slices.Contains([]string{"graphql", "rest"}, eVars.ApiBackend) {
+		err = fmt.Errorf("CODEOWNERS_API_BACKEND must be one of graphql, rest: '%v'", eVars.ApiBackend)
+	}
+	if err == nil && !slices.Contains([]string{"", "text", "json"}, eVars.ShowGlobs) {
+		err = fmt.Errorf("CODEOWNERS_SHOW_GLOBS must be one of text, json: '%v'", eVars.ShowGlobs)
+	}
+	if err == nil && eVars.FromStdin && eVars.Content != "" {
+		err = errors.New("--stdin and --content can't be used together, since they both provide the CODEOWNERS content")
+	}
+	if err == nil && !slices.Contains([]string{"text", "json"}, eVars.Format) {
+		err = fmt.Errorf("CODEOWNERS_FORMAT must be one of text, json: '%v'", eVars.Format)
+	}
+	if err == nil && !slices.Contains([]string{"check", "owner"}, eVars.OutputGroupBy) {
+		err = fmt.Errorf("CODEOWNERS_OUTPUT_GROUP_BY must be one of check, owner: '%v'", eVars.OutputGroupBy)
+	}
 	if err != nil {
 		fmt.Println("\nError " + err.Error())
-		os.Exit(1)
+		os.Exit(validate.ExitCodeInternal)
 	}
 }
 
-// Check codeowners syntax. Stop the program if there are syntax errors, since there's no sense in trying to
-// analyze a broken file.
-func checkSyntax(checker syntaxChecker, coFilePath string, projectPath string, branch string) {
-	err := checker.CheckCodeownersSyntax(coFilePath, projectPath, branch)
-	if err != nil {
-		fmt.Println("\nSyntax check of CODEOWNERS: FAILED")
-		fmt.Println(err.Error())
-		os.Exit(1)
+// Read the token from GITLAB_TOKEN_FILE, unless GITLAB_TOKEN is set, which takes precedence. If neither is set,
+// then use the password of the netrc file's entry for the GitLab host, if there is one. The token is never
+// included in the error, since it's a secret.
+func resolveGitlabToken(gArgs *gitlabArgs) error {
+	if gArgs.GitlabToken == "" && gArgs.GitlabTokenFile != "" {
+		content, err := os.ReadFile(gArgs.GitlabTokenFile)
+		if err != nil {
+			return fmt.Errorf("GITLAB_TOKEN_FILE '%v' cannot be read: %w", gArgs.GitlabTokenFile, err)
+		}
+		gArgs.GitlabToken = strings.TrimRight(string(content), "\r\n")
+	}
+	if gArgs.GitlabToken == "" {
+		token, err := readNetrcToken(gArgs.GitlabNetrcFile, gArgs.GitlabRestUrl)
+		if err != nil {
+			return err
+		}
+		gArgs.GitlabToken = token
+	}
+	if gArgs.GitlabToken == "" {
+		return errors.New(`env: environment variable "GITLAB_TOKEN" (or the file at "GITLAB_TOKEN_FILE", or a netrc entry for the GitLab host) should not be empty`)
 	}
-	fmt.Printf("\nSyntax check of '%v': PASSED\n", analysis.Co.CodeownersFilePath)
+	return nil
 }
 
-// Setup GitLab connections - return struct vars with connection info for both of the GitLab API packages
-func setupGitlabConnections(eVars envVarArgs) (graphql.Server, rest.Server) {
-	graphqlServer := graphql.Server{
-		GraphQlUrl:  eVars.GitlabGraphqlUrl,
-		GitlabToken: eVars.GitlabToken,
-		Timeout:     eVars.GitlabTimeoutSecs,
+// For --target-project and --codeowners-file, validate another project's CODEOWNERS file, ex: from a central
+// job with checkouts of many repos. The repo root is the checkout that contains the file, and the API calls target
+// the project, on the branch that's checked out.
+func applyTargetProject(eVars *envVarArgs) (err error) {
+	if eVars.TargetProject == "" && eVars.CodeownersFile == "" {
+		return nil
 	}
-	restServer := rest.Server{
-		RestUrl:     eVars.GitlabRestUrl,
-		GitlabToken: eVars.GitlabToken,
-		Timeout:     eVars.GitlabTimeoutSecs,
+	if eVars.TargetProject == "" || eVars.CodeownersFile == "" {
+		return errors.New("--target-project and --codeowners-file must be used together")
 	}
-	return graphqlServer, restServer
+	targetProject := strings.Trim(eVars.TargetProject, "/")
+	if !strings.Contains(targetProject, "/") {
+		return fmt.Errorf("--target-project '%v' must be the project's full path, ex: my-group/my-project", eVars.TargetProject)
+	}
+	eVars.RepoRoot, eVars.CodeownersPath, err = analysis.SplitCodeownersFilePath(eVars.CodeownersFile)
+	if err != nil {
+		return err
+	}
+	eVars.ProjectPath = targetProject
+	eVars.MergeRequestIid = 0 // A merge request in the CI project has nothing to do with the target project
+	if !eVars.DryRun && len(eVars.MergeReports) == 0 {
+		eVars.Branch, err = gitfiles.CurrentBranch(eVars.RepoRoot)
+		if err != nil {
+			return fmt.Errorf("--codeowners-file '%v' must be in a checkout of a branch of the target project: %w", eVars.CodeownersFile, err)
+		}
+	}
+	return nil
 }
 
-// Returns true if the results of a check indicate a pass (no error and leftovers is empty).
-// Returns false for failure(s). Prints the failure details to the console for the user to read.
-func checkAndPrintResults(checkName string, err error, leftovers []string, leftoverMsg string) (passed bool) {
-	passed = (len(leftovers) == 0 && err == nil)
-	status := "PASSED"
-	if !passed {
-		status = "FAILED"
-	}
-	fmt.Println("\n" + checkName + ": " + status)
-	indent := "     "
+// Return an error if the repo root isn't an existing directory
+func validateRepoRoot(repoRoot string) error {
+	stat, err := os.Stat(repoRoot)
 	if err != nil {
-		fmt.Println(indent + "error: " + err.Error())
-	} else if !passed {
-		fmt.Println(indent + leftoverMsg)
-		for _, leftover := range leftovers {
-			fmt.Println(indent + indent + leftover)
+		return fmt.Errorf("CODEOWNERS_REPO_ROOT '%v' cannot be used: %w", repoRoot, err)
+	}
+	if !stat.IsDir() {
+		return fmt.Errorf("CODEOWNERS_REPO_ROOT '%v' is not a directory", repoRoot)
+	}
+	return nil
+}
+
+// Return the extra CODEOWNERS locations as clean paths with forward slashes, like GitLab's supported locations,
+// so that they also match the file list of a bare repo. Each one must be relative to the repo root, and within it.
+func cleanExtraLocations(locations []string) (cleaned []string, err error) {
+	for _, location := range locations {
+		location = strings.TrimSpace(location)
+		if location == "" {
+			continue
 		}
+		if !filepath.IsLocal(location) {
+			return nil, fmt.Errorf("CODEOWNERS_EXTRA_LOCATIONS '%v' must be a path within the repo, relative to its root", location)
+		}
+		cleaned = append(cleaned, filepath.ToSlash(filepath.Clean(location)))
 	}
 	return
 }
 
-// Verify that each file pattern matches at least one file. Return any patterns that do not have any matches.
-func checkFilePatterns(filePatterns []string) (badPatterns []string, err error) {
-	for _, pattern := range filePatterns {
-		slog.Debug("checkFilePatterns(): Checking file pattern '" + pattern + "'")
-		if pattern == "*" { // No need to check this pattern, as it will always have at least one match (the CODEOWNERS file)
+// Print everything that the analysis parsed out of the CODEOWNERS file, i.e. everything that a real run would
+// verify. Handy for debugging why an owner or file pattern is (or isn't) being picked up by the parser.
+func printDryRun(co *analysis.CodeownersFileAnatomy) {
+	fmt.Printf("\nDry run of '%v': no API calls or file pattern checks were made\n", co.CodeownersFilePath)
+	printPatternList("Section headings", co.SectionHeadings)
+	printPatternList("File patterns", co.FilePatterns)
+	printPatternList("User and group patterns", co.UserAndGroupPatterns)
+	printPatternList("Wildcard owner patterns", co.WildcardOwners)
+	printPatternList("Role owner patterns", co.RoleOwners)
+	printPatternList("Special owner patterns", co.SpecialOwners)
+	printPatternList("Email patterns", co.EmailPatterns)
+	printPatternList("Malformed email patterns", co.MalformedEmails)
+	printPatternList("Ignored patterns", co.IgnoredPatterns)
+	printSections(co.Sections)
+}
+
+// Print how each section heading was parsed, ex:
+// "line 3: [Docs][2] has name 'Docs', 2 approvals, default owners: @alice @bob, entries: 4"
+func printSections(sections []analysis.Section) {
+	fmt.Printf("\nSections (%d):\n", len(sections))
+	indent := "     "
+	for _, section := range sections {
+		if section.Heading == "" {
+			fmt.Printf("%v(before the first heading) entries: %d\n", indent, len(section.Entries))
 			continue
 		}
-		globExpression := translateCoToGlob(pattern)
-		slog.Debug("checkFilePatterns(): translated to glob expression '" + globExpression + "'")
-		matches, matchErr := doublestar.Glob(globExpression)
-		if matchErr != nil {
-			err = fmt.Errorf("checkFilePatterns() error while evaluating glob '%v': %w", pattern, matchErr)
-			return
+		description := fmt.Sprintf("line %d: %v has name '%v'", section.Line, section.Heading, section.Name)
+		if section.Optional {
+			description += ", optional"
+		}
+		if section.ApprovalCount > 0 {
+			description += fmt.Sprintf(", %d approvals", section.ApprovalCount)
 		}
-		slog.Debug(fmt.Sprintf("checkFilePatterns(): found %d matches for glob expression '%v'", len(matches), globExpression))
-		if len(matches) == 0 {
-			badPatterns = append(badPatterns, pattern)
+		if len(section.DefaultOwners) > 0 {
+			description += ", default owners: " + strings.Join(section.DefaultOwners, " ")
 		}
+		fmt.Printf("%v%v, entries: %d\n", indent, description, len(section.Entries))
 	}
-	return
 }
 
-// Translate a CODEOWNERS file pattern into a standard glob expression.
-func translateCoToGlob(pattern string) (translatedPattern string) {
-	translatedPattern = pattern
-	if strings.HasPrefix(pattern, "/") {
-		// https://docs.gitlab.com/ee/user/project/codeowners/reference.html#absolute-paths
-		translatedPattern = "." + translatedPattern
-	} else {
-		// https://docs.gitlab.com/ee/user/project/codeowners/reference.html#relative-paths
-		translatedPattern = "./**/" + translatedPattern
-	}
-	if strings.HasSuffix(pattern, "/") {
-		// https://docs.gitlab.com/ee/user/project/codeowners/reference.html#directory-paths
-		translatedPattern = translatedPattern + "**/*"
+// Print a titled list of patterns, along with how many there are
+func printPatternList(title string, patterns []string) {
+	fmt.Printf("\n%v (%d):\n", title, len(patterns))
+	indent := "     "
+	for _, pattern := range patterns {
+		fmt.Println(indent + pattern)
 	}
-	return
 }
 
-// Check that owner entries (users, groups, emails) are direct members of the project. Since user and group owners are both
-// specified by "@name" and are therefore indistinguishable until checked, these are provided in a combined list.
-// Returns any remaining users/groups and emails that were not found as direct members of the project.
-func checkOwners(uChecker userChecker, gChecker groupChecker, projectFullPath string, ugList []string, emailList []string) (
-	remainingUsersGroups []string,
-	remainingEmails []string,
-	err error,
-) {
-	// Make editable copies of the lists, so that we can remove items as we verify them (i.e. check them off the list)
-	remainingUsersGroups = make([]string, len(ugList))
-	copy(remainingUsersGroups, ugList)
-	remainingEmails = make([]string, len(emailList))
-	copy(remainingEmails, emailList)
-
-	slog.Debug("checkOwners() is checking off groups that are direct members of the project...")
-	groupsFound, err := gChecker.GetDirectGroupMembers(projectFullPath)
-	if err != nil {
-		err = fmt.Errorf("checkOffUsersAndGroups() errored in gChecker.GetDirectGroupMembers(): %w", err)
+// Print the result of the syntax check. Each syntax error that GitLab found is followed by the content of the
+// lines that it applies to. GitLab checks the file on the branch, so the local file is only used to show the
+// lines, and it's skipped if it's not readable.
+func printSyntaxCheckResult(co *analysis.CodeownersFileAnatomy, result validate.CheckResult) {
+	switch {
+	case result.Status == validate.StatusPassed:
+		fmt.Printf("\nSyntax check of '%v': PASSED\n", co.CodeownersFilePath)
 		return
-	}
-	remainingUsersGroups = filterSlice(remainingUsersGroups, groupsFound)
-	if len(remainingUsersGroups) == 0 && len(remainingEmails) == 0 { // All checked off?
+	case result.Status != validate.StatusFailed:
+		printCheckResult(result)
 		return
 	}
-
-	slog.Debug("checkOwners() is checking off users+emails in groups that are direct members of the project...")
-	usernamesFound, emailsFound, err := uChecker.GetDirectUserMembers(projectFullPath, "INVITED_GROUPS")
-	if err != nil {
-		err = fmt.Errorf("checkOffUsersAndGroups() errored in uChecker.GetDirectUserMembers() INVITED_GROUPS: %w", err)
+	fmt.Println("\nSyntax check of CODEOWNERS: FAILED")
+	if result.Error != "" {
+		fmt.Println(result.Error)
 		return
 	}
-	remainingUsersGroups = filterSlice(remainingUsersGroups, usernamesFound)
-	remainingEmails = filterSlice(remainingEmails, emailsFound)
-	if len(remainingUsersGroups) == 0 && len(remainingEmails) == 0 { // All checked off?
-		return
+	localLines := co.CodeownersFileLines
+	if localLines == nil {
+		content, err := os.ReadFile(filepath.Join(co.RepoRoot, co.CodeownersFilePath))
+		if err != nil {
+			slog.Debug("Unable to read the local CODEOWNERS file to show the lines with syntax errors", slog.Any("error", err))
+		}
+		localLines = strings.Split(strings.ReplaceAll(string(content), "\r\n", "\n"), "\n")
+	}
+	for _, finding := range result.Findings {
+		validationError := graphql.ValidationError{Code: finding.Value, Lines: finding.Lines}
+		fmt.Println("     " + validationError.Error())
+		for _, lineNumber := range validationError.Lines {
+			if lineNumber >= 1 && lineNumber <= len(localLines) {
+				fmt.Printf("          line %d: %q\n", lineNumber, localLines[lineNumber-1])
+			}
+		}
+	}
+}
+
+// Print the results of a check to the console for the user to read
+func printCheckResult(result validate.CheckResult) {
+	fmt.Println("\n" + result.Name + ": " + result.Status)
+	indent := "     "
+	if result.Error != "" {
+		fmt.Println(indent + "error: " + result.Error)
+	} else if result.Status == validate.StatusSkipped {
+		fmt.Println(indent + result.Message)
+	} else if len(result.Findings) > 0 {
+		fmt.Println(indent + result.Message)
+		for _, finding := range result.Findings {
+			fmt.Println(indent + indent + finding.String())
+		}
 	}
+}
 
-	slog.Debug("checkOwners() is checking off users+emails that are themselves direct members of the project...")
-	usernamesFound, emailsFound, err = uChecker.GetDirectUserMembers(projectFullPath, "DIRECT")
+// Print the whole CodeownersFileAnatomy as JSON, and nothing else, so that editors and other CI steps can use the
+// parser's results without re-implementing it, ex: "validate-codeowners analyze --format=json | jq .sections"
+func printAnatomyJson(co *analysis.CodeownersFileAnatomy) {
+	anatomyJson, err := json.MarshalIndent(co, "", "  ")
 	if err != nil {
-		err = fmt.Errorf("checkOffUsersAndGroups() errored in uChecker.GetDirectUserMembers() DIRECT: %w", err)
-		return
+		fmt.Println("\nError printAnatomyJson() could not encode JSON: " + err.Error())
+		os.Exit(validate.ExitCodeInternal)
 	}
-	remainingUsersGroups = filterSlice(remainingUsersGroups, usernamesFound)
-	remainingEmails = filterSlice(remainingEmails, emailsFound)
-	return
+	fmt.Println(string(anatomyJson))
 }
 
-// Take the "original" slice and remove all the elements that intersect with the "filterAgainst"
-// slice. Return the new slice.
-func filterSlice(original []string, filterAgainst []string) (filteredList []string) {
-	slog.Debug("filterSlice() is filtering original slice: " + strings.Join(original, " "))
-	// Max size of the filtered output list is the original list size (if no elements intersect)
-	filteredList = make([]string, 0, len(original))
-	// Check each element of the original list against the filterAgainst list
-	for _, originalElement := range original {
-		intersect := slices.IndexFunc(filterAgainst, func(e string) bool {
-			return e == originalElement
-		})
-		// If this element is not in filterAgainst, then keep it
-		if intersect == -1 {
-			filteredList = append(filteredList, originalElement)
+// Print the glob expression that each CODEOWNERS file pattern is translated into, in either "text" or "json"
+// format. Prints nothing if format is empty. Handy for understanding why a file pattern does or doesn't match.
+func printGlobTranslations(format string, repoRoot string, filePatterns []string) {
+	type globTranslation struct {
+		Pattern string `json:"pattern"`
+		Glob    string `json:"glob"`
+	}
+	translations := make([]globTranslation, 0, len(filePatterns))
+	for _, pattern := range filePatterns {
+		translations = append(translations, globTranslation{Pattern: pattern, Glob: validate.TranslateCoToGlob(repoRoot, pattern)})
+	}
+	switch format {
+	case "text":
+		fmt.Println("\nFile pattern glob translations:")
+		indent := "     "
+		for _, t := range translations {
+			fmt.Println(indent + t.Pattern + " => " + t.Glob)
 		}
+	case "json":
+		translationsJson, err := json.MarshalIndent(translations, "", "  ")
+		if err != nil {
+			slog.Error("printGlobTranslations() could not encode JSON: " + err.Error())
+			return
+		}
+		fmt.Println("\n" + string(translationsJson))
 	}
-	return
 }
 
 // Set slog's handler to either Info or Debug logging level
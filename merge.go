@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/bmatcuk/doublestar"
+	"gitlab.com/tedspinks/validate-codeowners/validate"
+)
+
+// Merge the JSON reports from earlier runs (ex: parallel CI jobs that each validated part of a big repo) into
+// one report, and print it. Each entry of reportPaths may be a glob, ex: "reports/*.json". Checks with the same
+// name are combined, a combined check fails if any of its runs failed, and findings that show up in more than
+// one run (i.e. that have the same fingerprint) are only reported once.
+func mergeReports(reportPaths []string) {
+	files, err := expandReportPaths(reportPaths)
+	if err != nil {
+		fmt.Println("\nError " + err.Error())
+		os.Exit(validate.ExitCodeInternal)
+	}
+	fmt.Printf("\nMerging %d reports: %v\n", len(files), strings.Join(files, ", "))
+	for _, file := range files {
+		var partial validate.Report
+		content, err := os.ReadFile(file)
+		if err == nil {
+			err = json.Unmarshal(content, &partial)
+		}
+		if err == nil && partial.SchemaVersion != validate.ReportSchemaVersion {
+			err = fmt.Errorf("unsupported schemaVersion %d, expected %d", partial.SchemaVersion, validate.ReportSchemaVersion)
+		}
+		if err != nil {
+			fmt.Printf("\nError unable to read JSON report '%v': %v\n", file, err.Error())
+			os.Exit(validate.ExitCodeInternal)
+		}
+		for _, check := range partial.Checks {
+			mergeCheckResult(check)
+		}
+		report.Summary.AddOwners(partial.Summary)
+	}
+	for _, check := range report.Checks {
+		printCheckResult(check)
+	}
+	if report.MostSevereExitCode() != validate.ExitCodeSuccess {
+		fmt.Println("\nSee failures noted above.")
+	}
+}
+
+// Merge a check's result into the report, combining it with any earlier result for the same check
+func mergeCheckResult(check validate.CheckResult) {
+	for i := range report.Checks {
+		merged := &report.Checks[i]
+		if merged.Name != check.Name {
+			continue
+		}
+		if check.Status == validate.StatusFailed || (check.Status == validate.StatusWarning && merged.Status == validate.StatusPassed) {
+			merged.Status = check.Status
+			if merged.Message == "" {
+				merged.Message = check.Message
+			}
+		}
+		if check.ExitCode != validate.ExitCodeSuccess && (merged.ExitCode == validate.ExitCodeSuccess || check.ExitCode < merged.ExitCode) {
+			merged.ExitCode = check.ExitCode
+		}
+		if check.Error != "" && !strings.Contains(merged.Error, check.Error) {
+			merged.Error = strings.TrimPrefix(merged.Error+"; "+check.Error, "; ")
+		}
+		for _, finding := range check.Findings {
+			isDuplicate := slices.ContainsFunc(merged.Findings, func(f validate.Finding) bool {
+				return f.Fingerprint == finding.Fingerprint
+			})
+			if !isDuplicate {
+				merged.Findings = append(merged.Findings, finding)
+			}
+		}
+		return
+	}
+	if check.Findings == nil {
+		check.Findings = []validate.Finding{}
+	}
+	report.Checks = append(report.Checks, check)
+}
+
+// Expand any globs in the list of report paths. A path that isn't a glob must exist, and a glob must match
+// at least one file.
+func expandReportPaths(reportPaths []string) (files []string, err error) {
+	for _, reportPath := range reportPaths {
+		reportPath = strings.TrimSpace(reportPath)
+		matches, globErr := doublestar.Glob(reportPath)
+		if globErr != nil {
+			return nil, fmt.Errorf("cannot evaluate report path '%v': %w", reportPath, globErr)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no JSON reports found at '%v'", reportPath)
+		}
+		files = append(files, matches...)
+	}
+	return
+}
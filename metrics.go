@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"gitlab.com/tedspinks/validate-codeowners/analysis"
+	"gitlab.com/tedspinks/validate-codeowners/transport"
+	"gitlab.com/tedspinks/validate-codeowners/validate"
+)
+
+// Push a few metrics about the run to a Prometheus pushgateway through the transport t, in the text exposition
+// format, so that CODEOWNERS health can be tracked over time. The metrics are grouped by job and project path. co
+// is the CODEOWNERS file that was validated, for the owner count.
+func pushMetrics(pushgatewayUrl string, projectPath string, t http.RoundTripper, timeoutSecs int,
+	co *analysis.CodeownersFileAnatomy) (err error) {
+	// The project path contains slashes, so it must be base64 encoded in the grouping key
+	encodedProject := base64.RawURLEncoding.EncodeToString([]byte(projectPath))
+	endpointUrl := strings.TrimSuffix(pushgatewayUrl, "/") + "/metrics/job/validate_codeowners/project@base64/" + encodedProject
+	res, err := transport.NewClient(t, timeoutSecs).Post(endpointUrl, "text/plain; version=0.0.4", strings.NewReader(formatMetrics(co)))
+	if err != nil {
+		return fmt.Errorf("pushMetrics() error pushing to '%v': %w", endpointUrl, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("pushMetrics() push to '%v' returned status %d", endpointUrl, res.StatusCode)
+	}
+	return nil
+}
+
+// Format the metrics in the Prometheus text exposition format
+func formatMetrics(co *analysis.CodeownersFileAnatomy) string {
+	checksFailed := 0
+	filePatternsMissing := 0
+	for _, check := range report.Checks {
+		if check.Status == validate.StatusFailed {
+			checksFailed++
+		}
+		if check.Name == "File pattern check" {
+			filePatternsMissing += len(check.Findings)
+		}
+	}
+	ownersTotal := len(co.UserAndGroupPatterns) + len(co.EmailPatterns)
+	var metrics strings.Builder
+	writeGauge := func(name string, help string, value any) {
+		fmt.Fprintf(&metrics, "# HELP codeowners_%v %v\n# TYPE codeowners_%v gauge\ncodeowners_%v %v\n", name, help, name, name, value)
+	}
+	writeGauge("checks_failed", "Number of checks that failed.", checksFailed)
+	writeGauge("owners_total", "Number of distinct users, groups, and emails in the CODEOWNERS file.", ownersTotal)
+	writeGauge("owners_missing", "Number of owners that are not direct members of the project.", report.Summary.OwnersMissing)
+	writeGauge("file_patterns_missing", "Number of file patterns that do not match any files.", filePatternsMissing)
+	writeGauge("run_duration_seconds", "Duration of the run.", time.Since(runStart).Seconds())
+	return metrics.String()
+}
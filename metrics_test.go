@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gitlab.com/tedspinks/validate-codeowners/analysis"
+	"gitlab.com/tedspinks/validate-codeowners/transport"
+	"gitlab.com/tedspinks/validate-codeowners/validate"
+)
+
+func TestPushMetricsUsesTheTransport(t *testing.T) {
+	var proxiedUrl string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxiedUrl = r.URL.String()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer proxy.Close()
+	proxyTransport, err := transport.New(proxy.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The pushgateway's host doesn't exist, so the push only succeeds through the proxy
+	err = pushMetrics("http://pushgateway.invalid:9091", "my-group/my-project", proxyTransport, 5, analysis.New(""))
+	if err != nil {
+		t.Fatalf("pushMetrics() error = %v", err)
+	}
+	want := "http://pushgateway.invalid:9091/metrics/job/validate_codeowners/project@base64/bXktZ3JvdXAvbXktcHJvamVjdA"
+	if proxiedUrl != want {
+		t.Errorf("the proxy got a request for %q, want %q", proxiedUrl, want)
+	}
+}
+
+func TestFormatMetrics(t *testing.T) {
+	savedReport := report
+	defer func() { report = savedReport }()
+	// The missing owners are spread across the checks that classify them, so they're counted from the summary
+	report = validate.Report{
+		Checks: []validate.CheckResult{
+			{Name: "Direct user and group membership check", Status: validate.StatusPassed},
+			{Name: "Nonexistent owner check", Status: validate.StatusFailed, Findings: []validate.Finding{{Value: "ghost"}}},
+			{Name: "Group existence check", Status: validate.StatusFailed, Findings: []validate.Finding{{Value: "my-group/typo"}}},
+			{Name: "File pattern check", Status: validate.StatusFailed, Findings: []validate.Finding{{Value: "/missing/"}}},
+			{Name: "Separator check", Status: validate.StatusWarning, Findings: []validate.Finding{{Value: "line 3"}}},
+		},
+		Summary: validate.Summary{OwnersVerified: 1, OwnersMissing: 2},
+	}
+	co := analysis.New("")
+	co.LoadContent("*.md @alice @ghost @my-group/typo\n/missing/ alice@example.com\n")
+	co.Analyze()
+
+	metrics := formatMetrics(co)
+	for _, want := range []string{
+		"codeowners_checks_failed 3\n",
+		"codeowners_owners_total 4\n",
+		"codeowners_owners_missing 2\n",
+		"codeowners_file_patterns_missing 1\n",
+		"# TYPE codeowners_run_duration_seconds gauge\ncodeowners_run_duration_seconds ",
+	} {
+		if !strings.Contains(metrics, want) {
+			t.Errorf("formatMetrics() is missing %q:\n%v", want, metrics)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Return the password of the netrc file's "machine" entry for the host of gitlabUrl, so that developers can keep
+// the token in the same place as their git credentials. netrcPath defaults to ~/.netrc, which is skipped if it
+// doesn't exist. Returns "" if no entry matches. The "default" entry isn't used, since it would send the token
+// to any host. The token is never logged, and never included in an error.
+func readNetrcToken(netrcPath string, gitlabUrl string) (token string, err error) {
+	isDefaultPath := netrcPath == ""
+	if isDefaultPath {
+		home, homeErr := os.UserHomeDir()
+		if homeErr != nil {
+			return "", nil // No home directory, so no ~/.netrc
+		}
+		netrcPath = filepath.Join(home, ".netrc")
+	}
+	content, err := os.ReadFile(netrcPath)
+	if isDefaultPath && errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("GITLAB_NETRC_FILE '%v' cannot be read: %w", netrcPath, err)
+	}
+	u, err := neturl.Parse(gitlabUrl)
+	if err != nil || u.Hostname() == "" {
+		return "", fmt.Errorf("cannot find the host in GitLab URL '%v' to look up in '%v'", gitlabUrl, netrcPath)
+	}
+	token, _ = netrcPassword(string(content), u.Hostname())
+	return token, nil
+}
+
+// Return the password of the "machine" entry for the host in the netrc content, ex:
+//
+//	machine gitlab.example.com login my-user password glpat-xxxxxxxx
+//
+// The tokens can be separated by any whitespace, including newlines. Entries after a "macdef" macro are not read.
+func netrcPassword(content string, host string) (password string, found bool) {
+	var machine string
+	fields := strings.Fields(content)
+	for i := 0; i < len(fields); i++ {
+		switch fields[i] {
+		case "machine":
+			if i+1 < len(fields) {
+				i++
+				machine = fields[i]
+			}
+		case "default":
+			machine = ""
+		case "password":
+			if i+1 < len(fields) {
+				i++
+				if strings.EqualFold(machine, host) {
+					return fields[i], true
+				}
+			}
+		case "login", "account":
+			if i+1 < len(fields) {
+				i++ // Skip the value
+			}
+		case "macdef":
+			// A macro runs until the next blank line, which strings.Fields() can't see, so stop looking
+			return "", false
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNetrcPassword(t *testing.T) {
+	tests := []struct {
+		name         string
+		content      string
+		wantPassword string
+		wantFound    bool
+	}{
+		{"one line", "machine gitlab.example.com login me password glpat-1", "glpat-1", true},
+		{"across lines", "machine gitlab.example.com\n\tlogin me\n\tpassword glpat-1\n", "glpat-1", true},
+		{"host casing", "machine GitLab.Example.com password glpat-1", "glpat-1", true},
+		{"second machine", "machine other.example.com password other\nmachine gitlab.example.com password glpat-1",
+			"glpat-1", true},
+		{"other machine only", "machine other.example.com login me password other", "", false},
+		{"default isn't used", "default login me password anywhere", "", false},
+		{"default after the machine", "machine gitlab.example.com login me default password anywhere", "", false},
+		{"machine after default", "default password anywhere machine gitlab.example.com password glpat-1", "glpat-1", true},
+		{"login that looks like a keyword", "machine gitlab.example.com login password password glpat-1", "glpat-1", true},
+		{"account", "machine gitlab.example.com account acct password glpat-1", "glpat-1", true},
+		{"entries after a macdef", "macdef init\ncd /\n\nmachine gitlab.example.com password glpat-1", "", false},
+		{"empty", "", "", false},
+		{"truncated after machine", "machine", "", false},
+		{"truncated after the host", "machine gitlab.example.com", "", false},
+		{"truncated after login", "machine gitlab.example.com login", "", false},
+		{"truncated after account", "machine gitlab.example.com account", "", false},
+		{"truncated after password", "machine gitlab.example.com login me password", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			password, found := netrcPassword(tt.content, "gitlab.example.com")
+			if password != tt.wantPassword || found != tt.wantFound {
+				t.Errorf("netrcPassword() = %q, %v, want %q, %v", password, found, tt.wantPassword, tt.wantFound)
+			}
+		})
+	}
+}
+
+func TestReadNetrcToken(t *testing.T) {
+	netrcPath := filepath.Join(t.TempDir(), "netrc")
+	if err := os.WriteFile(netrcPath, []byte("machine gitlab.example.com login me password glpat-1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	token, err := readNetrcToken(netrcPath, "https://gitlab.example.com/api/v4")
+	if err != nil || token != "glpat-1" {
+		t.Errorf("readNetrcToken() = %q, %v, want the entry's password", token, err)
+	}
+	// Unlike a missing ~/.netrc, a custom path that can't be read is an error
+	_, err = readNetrcToken(filepath.Join(t.TempDir(), "missing"), "https://gitlab.example.com/api/v4")
+	if err == nil {
+		t.Error("readNetrcToken() of a missing GITLAB_NETRC_FILE error = nil, want an error")
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"gitlab.com/tedspinks/validate-codeowners/validate"
+)
+
+// Ping GitLab's APIs, print whether each one is reachable and accepts the token, and exit. Exits with
+// validate.ExitCodeInternal if either API has a problem, since that's what a real run would fail with.
+func runPing(cfg validate.Config) {
+	results, err := validate.Ping(cfg)
+	if err != nil {
+		fmt.Println("\nError " + err.Error())
+		os.Exit(validate.ExitCodeInternal)
+	}
+	fmt.Println("\nPing of GitLab's APIs:")
+	indent := "     "
+	exitCode := validate.ExitCodeSuccess
+	for _, result := range results {
+		latency := result.Latency.Round(time.Millisecond)
+		switch {
+		case !result.Reachable:
+			fmt.Printf("%v%v API (%v): not reachable after %v: %v\n", indent, result.Api, result.Url, latency, result.Detail)
+		case !result.TokenValid:
+			fmt.Printf("%v%v API (%v): reachable in %v, but the token isn't valid: %v\n", indent, result.Api, result.Url, latency, result.Detail)
+		default:
+			fmt.Printf("%v%v API (%v): reachable in %v, token is valid: %v\n", indent, result.Api, result.Url, latency, result.Detail)
+		}
+		if !result.Reachable || !result.TokenValid {
+			exitCode = validate.ExitCodeInternal
+		}
+	}
+	if exitCode == validate.ExitCodeSuccess {
+		fmt.Println("\nPing passed")
+	} else {
+		fmt.Println("\nPing failed")
+	}
+	os.Exit(exitCode)
+}
@@ -0,0 +1,57 @@
+// This package provides a client-side rate limiter that is shared by the graphql and rest packages, so that the
+// tool throttles itself instead of tripping GitLab's API rate limits (HTTP 429) in the middle of a run.
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// A token bucket that allows up to the configured number of requests per second, with bursts of up to one
+// second's worth of requests. A nil *Limiter is valid, and never waits.
+type Limiter struct {
+	mu                sync.Mutex
+	requestsPerSecond float64
+	burst             float64   // Max tokens that the bucket can hold
+	tokens            float64   // Tokens currently in the bucket
+	lastRefill        time.Time // When tokens was last updated
+}
+
+// Return a limiter that allows requestsPerSecond. Returns nil (i.e. no limit) if requestsPerSecond is zero or
+// less.
+func New(requestsPerSecond float64) *Limiter {
+	if requestsPerSecond <= 0 {
+		return nil
+	}
+	burst := max(requestsPerSecond, 1)
+	return &Limiter{
+		requestsPerSecond: requestsPerSecond,
+		burst:             burst,
+		tokens:            burst,
+		lastRefill:        time.Now(),
+	}
+}
+
+// Block until a request is allowed. Call this before each HTTP request.
+func (l *Limiter) Wait() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill()
+	if l.tokens < 1 {
+		// Sleep while holding the lock, so that waiting requests are let through one at a time, in order
+		wait := time.Duration((1 - l.tokens) / l.requestsPerSecond * float64(time.Second))
+		time.Sleep(wait)
+		l.refill()
+	}
+	l.tokens--
+}
+
+// Add the tokens that have accumulated since the last refill, up to the burst size
+func (l *Limiter) refill() {
+	now := time.Now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.lastRefill).Seconds()*l.requestsPerSecond)
+	l.lastRefill = now
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"gitlab.com/tedspinks/validate-codeowners/validate"
+)
+
+// Results of every check that has run, in the order that they ran
+var report validate.Report
+
+// Write the report as JSON to CODEOWNERS_JSON_REPORT and POST it to CODEOWNERS_WEBHOOK_URL (if they're set), and
+// then exit with the most severe failure's exit code. A failed webhook is only a warning, so it can't change the
+// exit code.
+func exitWithReport(eVars envVarArgs) {
+	jsonReportPath := eVars.JsonReport
+	printTimings()
+	finishReport()
+	if jsonReportPath != "" {
+		reportJson, err := json.MarshalIndent(report, "", "  ")
+		if err == nil {
+			err = os.WriteFile(jsonReportPath, reportJson, 0644)
+		}
+		if err != nil {
+			fmt.Printf("\nError unable to write JSON report to '%v': %v\n", jsonReportPath, err.Error())
+			os.Exit(validate.ExitCodeInternal)
+		}
+	}
+	sendWebhook(eVars)
+	printSummary(report.Summary)
+	os.Exit(report.ExitCode)
+}
+
+// Print the error that stopped the validation, and exit with ExitCodeInternal. The report (with the checks that
+// ran before the error, and the error in its notes) is still POSTed to CODEOWNERS_WEBHOOK_URL, so that the webhook
+// hears about every run.
+func exitWithError(eVars envVarArgs, err error) {
+	fmt.Println("\nError " + err.Error())
+	finishReport()
+	report.ExitCode = validate.ExitCodeInternal
+	report.Passed = false
+	report.Notes = append(report.Notes, "Error "+err.Error())
+	sendWebhook(eVars)
+	os.Exit(validate.ExitCodeInternal)
+}
+
+// Fill in the report's exit code, pass/fail, and summary from its checks
+func finishReport() {
+	report.SchemaVersion = validate.ReportSchemaVersion
+	report.ExitCode = report.MostSevereExitCode()
+	report.Passed = report.ExitCode == validate.ExitCodeSuccess
+	report.Summary = report.Summarize()
+}
+
+// POST the report to CODEOWNERS_WEBHOOK_URL, if it's set. A failed webhook is only a warning.
+func sendWebhook(eVars envVarArgs) {
+	if eVars.WebhookUrl == "" {
+		return
+	}
+	err := postWebhook(eVars.WebhookUrl, eVars.webhookHeaders, eVars.httpTransport, eVars.GitlabTimeoutSecs)
+	if err != nil {
+		fmt.Println("\nWarning " + err.Error())
+	}
+}
+
+// Print a one-line summary of the run, ex: "4 checks passed, 2 failed, 1 warning; 37 owners verified, 3 missing."
+func printSummary(summary validate.Summary) {
+	counts := []string{validate.CountOf(summary.Passed, "check") + " passed", fmt.Sprintf("%d failed", summary.Failed)}
+	if summary.Warnings > 0 {
+		counts = append(counts, validate.CountOf(summary.Warnings, "warning"))
+	}
+	if summary.Skipped > 0 {
+		counts = append(counts, fmt.Sprintf("%d skipped", summary.Skipped))
+	}
+	line := strings.Join(counts, ", ")
+	if summary.OwnersVerified > 0 || summary.OwnersMissing > 0 {
+		line += fmt.Sprintf("; %v verified, %d missing", validate.CountOf(summary.OwnersVerified, "owner"), summary.OwnersMissing)
+	}
+	fmt.Println("\nSummary: " + line + ".")
+}
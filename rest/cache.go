@@ -0,0 +1,47 @@
+package rest
+
+import "sync"
+
+// Remembers the projects that were looked up by path, so that each project is only fetched once per run, even
+// though several checks need it. A nil *ProjectCache is valid, and never caches anything. Call Clear() to reuse
+// a Server across runs whose projects may have changed.
+type ProjectCache struct {
+	mu       sync.Mutex
+	projects map[string]*Project // Full path -> project, or nil if the project isn't visible
+}
+
+// Return an empty cache
+func NewProjectCache() *ProjectCache {
+	return &ProjectCache{projects: map[string]*Project{}}
+}
+
+// Return the cached project for the full path, and whether it was cached at all (a nil project can be cached)
+func (c *ProjectCache) get(projectFullPath string) (project *Project, found bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	project, found = c.projects[projectFullPath]
+	return
+}
+
+// Cache the project (or nil, if it isn't visible) for the full path
+func (c *ProjectCache) set(projectFullPath string, project *Project) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.projects[projectFullPath] = project
+}
+
+// Remove all the cached projects
+func (c *ProjectCache) Clear() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.projects)
+}
@@ -0,0 +1,122 @@
+package rest_test
+
+import (
+	"slices"
+	"testing"
+
+	"gitlab.com/tedspinks/validate-codeowners/rest"
+	"gitlab.com/tedspinks/validate-codeowners/testutil"
+)
+
+// Start a fake GitLab with a "my-group/my-project" project, which has 3 direct members and is shared with a group
+// that has 1 member. Each page has 1 member, so that pagination gets exercised.
+func startFakeGitLab(t *testing.T) rest.Server {
+	t.Helper()
+	gitlab := &testutil.GitLab{
+		Projects: map[string]rest.Project{"my-group/my-project": {Id: 100, PathWithNamespace: "my-group/my-project",
+			SharedWithGroups: []rest.Group{{GroupId: 10, GroupFullPath: "my-group/team"}}}},
+		DirectMembers: map[string][]rest.Member{"my-group/my-project": {
+			{Id: 1, Username: "alice", PublicEmail: "alice@example.com"},
+			{Id: 2, Username: "bob", Email: "bob@example.com"},
+			{Id: 3, Username: "carol"},
+		}},
+		GroupMembers: map[int][]rest.Member{10: {{Id: 4, Username: "dave"}}},
+		PageSize:     1,
+	}
+	gitlab.Start()
+	t.Cleanup(gitlab.Close)
+	return rest.Server{RestUrl: gitlab.RestUrl(), GitlabToken: "test-token", Timeout: 5}
+}
+
+func TestGetDirectUserMembers(t *testing.T) {
+	server := startFakeGitLab(t)
+	tests := []struct {
+		userSource    string
+		wantUsernames []string
+		wantEmails    []string
+	}{
+		{"DIRECT", []string{"alice", "bob", "carol"}, []string{"alice@example.com", "bob@example.com"}},
+		{"INVITED_GROUPS", []string{"dave"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.userSource, func(t *testing.T) {
+			usernames, emails, err := server.GetDirectUserMembers("my-group/my-project", tt.userSource)
+			if err != nil {
+				t.Fatalf("GetDirectUserMembers() error = %v", err)
+			}
+			if !slices.Equal(usernames, tt.wantUsernames) {
+				t.Errorf("GetDirectUserMembers() usernames = %v, want %v", usernames, tt.wantUsernames)
+			}
+			if !slices.Equal(emails, tt.wantEmails) {
+				t.Errorf("GetDirectUserMembers() emails = %v, want %v", emails, tt.wantEmails)
+			}
+		})
+	}
+}
+
+func TestGetProjectByPath(t *testing.T) {
+	gitlab := &testutil.GitLab{Projects: map[string]rest.Project{
+		"my-group/my-project":             {Id: 100, PathWithNamespace: "my-group/my-project"},
+		"my-group/sub/deeper/the-project": {Id: 101, PathWithNamespace: "my-group/sub/deeper/the-project"},
+	}}
+	gitlab.Start()
+	defer gitlab.Close()
+	server := rest.Server{RestUrl: gitlab.RestUrl(), GitlabToken: "test-token", Timeout: 5}
+
+	tests := []struct {
+		path   string
+		wantId int // 0 for a project that isn't visible, which isn't an error, it's just nil
+	}{
+		{"/my-group/my-project", 100},
+		{"my-group/sub/deeper/the-project", 101},
+		{"my-group/missing-project", 0},
+		{"my-group/sub/deeper/missing-project", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			project, err := server.GetProjectByPath(tt.path)
+			if err != nil {
+				t.Fatalf("GetProjectByPath() error = %v", err)
+			}
+			if tt.wantId == 0 {
+				if project != nil {
+					t.Errorf("GetProjectByPath() = %+v, want nil", project)
+				}
+				return
+			}
+			if project == nil || project.Id != tt.wantId {
+				t.Errorf("GetProjectByPath() = %+v, want project %d", project, tt.wantId)
+			}
+		})
+	}
+}
+
+func TestSpecialCharactersAreEscapedInPaths(t *testing.T) {
+	projectPath := `my-group/o'brien "quoted" project?#`
+	groupPath := "my-group/team with spaces"
+	username := "first.last-name"
+	gitlab := &testutil.GitLab{
+		Projects:      map[string]rest.Project{projectPath: {Id: 100, PathWithNamespace: projectPath}},
+		DirectMembers: map[string][]rest.Member{projectPath: {{Id: 1, Username: username}}},
+		Groups:        []rest.GroupDetails{{Id: 10, Name: "team with spaces", FullPath: groupPath}},
+	}
+	gitlab.Start()
+	defer gitlab.Close()
+	server := rest.Server{RestUrl: gitlab.RestUrl(), GitlabToken: "test-token", Timeout: 5}
+
+	usernames, _, err := server.GetDirectUserMembers(projectPath, "DIRECT")
+	if err != nil {
+		t.Fatalf("GetDirectUserMembers() error = %v", err)
+	}
+	if !slices.Equal(usernames, []string{username}) {
+		t.Errorf("GetDirectUserMembers() usernames = %v, want [%v]", usernames, username)
+	}
+	project, err := server.GetProjectByPath(projectPath)
+	if err != nil || project == nil || project.Id != 100 {
+		t.Errorf("GetProjectByPath() = %+v, %v, want project 100", project, err)
+	}
+	group, err := server.GetGroupByPath(groupPath)
+	if err != nil || group == nil || group.Id != 10 {
+		t.Errorf("GetGroupByPath() = %+v, %v, want group 10", group, err)
+	}
+}
@@ -1,33 +1,273 @@
 package rest
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	neturl "net/url"
+	"strconv"
 	"strings"
-	"time"
+
+	"gitlab.com/tedspinks/validate-codeowners/transport"
 )
 
+// Max page size of GitLab's REST API
+const maxPerPage = 100
+
 // Return the full path (ex: top-group/sub-group/etc-group) of all the groups that are direct members of the
 // specified project.
 func (server Server) GetDirectGroupMembers(projectFullPath string) (groups []string, err error) {
-	project, err := server.GetProjectByPath(projectFullPath)
+	sharedGroups, err := server.GetSharedGroups(projectFullPath)
 	if err != nil {
 		err = fmt.Errorf("GetDirectGroupMembers(): %w", err)
 		return
 	}
+	for _, group := range sharedGroups {
+		groups = append(groups, group.GroupFullPath)
+	}
+	return
+}
+
+// Return the usernames and emails of the project's members, the same way as the GraphQL package's
+// GetDirectUserMembers(), for GitLab instances that have the GraphQL API disabled. userSource must be one of:
+//   - DIRECT: users who are direct members of the project
+//   - INVITED_GROUPS: users who are members of the groups that the project is shared with
+//
+// Emails are only returned if they are visible to the server.GitlabToken identity (ex: for an admin).
+func (server Server) GetDirectUserMembers(projectFullPath string, userSource string) (usernamesFound []string, emailsFound []string, err error) {
+	var members []Member
+	switch userSource {
+	case "DIRECT":
+		projectFullPath = strings.Trim(projectFullPath, "/")
+		endpointPath := "/projects/" + neturl.PathEscape(projectFullPath) + "/members"
+		members, err = server.getMembers(endpointPath)
+	case "INVITED_GROUPS":
+		var sharedGroups []Group
+		sharedGroups, err = server.GetSharedGroups(projectFullPath)
+		for _, group := range sharedGroups {
+			if err != nil {
+				break
+			}
+			var groupMembers []Member
+			groupMembers, err = server.GetGroupMembers(group.GroupId)
+			members = append(members, groupMembers...)
+		}
+	default:
+		panic("GetDirectUserMembers() userSource must be one of DIRECT, INVITED_GROUPS: '" + userSource + "'")
+	}
+	if err != nil {
+		err = fmt.Errorf("GetDirectUserMembers() failed listing %v members of project '%v': %w", userSource, projectFullPath, err)
+		return
+	}
+	for _, member := range members {
+		usernamesFound = append(usernamesFound, member.Username)
+		if member.PublicEmail != "" {
+			emailsFound = append(emailsFound, member.PublicEmail)
+		}
+		if member.Email != "" && member.Email != member.PublicEmail {
+			emailsFound = append(emailsFound, member.Email)
+		}
+	}
+	return
+}
+
+// Return all the members of a group, including members inherited from its parent groups
+func (server Server) GetGroupMembers(groupId int) (members []Member, err error) {
+	members, err = server.getMembers(fmt.Sprintf("/groups/%d/members/all", groupId))
+	if err != nil {
+		err = fmt.Errorf("GetGroupMembers() failed listing members of group ID '%d': %w", groupId, err)
+	}
+	return
+}
+
+// Return all the members from a members endpoint, ex: /projects/:id/members, reading every page of results
+func (server Server) getMembers(endpointPath string) (members []Member, err error) {
+	pagePath := fmt.Sprintf("%v?per_page=%d", endpointPath, maxPerPage)
+	_, jsonResponse, err := server.RestRequestAllPages(pagePath)
+	if err != nil {
+		return nil, fmt.Errorf("getMembers(): %w", err)
+	}
+	err = json.Unmarshal(jsonResponse, &members)
+	if err != nil {
+		return nil, fmt.Errorf("getMembers() could not decode JSON response '%v' from '%v': %w", string(jsonResponse), pagePath, err)
+	}
+	return members, nil
+}
+
+// Returned (wrapped) when the project doesn't exist, or the server.GitlabToken identity can't see it. Without
+// the project, none of its members can be listed, so every owner would look like a non-member.
+var ErrProjectNotFound = errors.New("project not found or not visible to the token")
+
+// Return all the groups that the specified project is shared with (i.e. groups that are direct members of the
+// project), including each group's ID and access level. Returns ErrProjectNotFound (wrapped) if the project
+// can't be found.
+func (server Server) GetSharedGroups(projectFullPath string) (groups []Group, err error) {
+	project, err := server.GetProjectByPath(projectFullPath)
+	if err != nil {
+		err = fmt.Errorf("GetSharedGroups(): %w", err)
+		return
+	}
 	if project == nil {
+		err = fmt.Errorf("GetSharedGroups() project '%v': %w", projectFullPath, ErrProjectNotFound)
 		return
 	}
-	for _, group := range project.SharedWithGroups {
-		groups = append(groups, group.GroupFullPath)
+	return project.SharedWithGroups, nil
+}
+
+// Return all the protected branches of the specified project, including wildcard ones (ex: "release/*"). Use
+// MatchingProtectedBranches() to find the ones that apply to a branch. Returns ErrProjectNotFound (wrapped) if the
+// project can't be found (or its protected branches aren't visible to the server.GitlabToken identity).
+func (server Server) GetProtectedBranches(projectFullPath string) (protectedBranches []ProtectedBranch, err error) {
+	projectFullPath = strings.Trim(projectFullPath, "/")
+	pagePath := fmt.Sprintf("/projects/%v/protected_branches?per_page=%d", neturl.PathEscape(projectFullPath), maxPerPage)
+	statusCode, jsonResponse, err := server.RestRequestAllPages(pagePath)
+	if statusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("GetProtectedBranches() project '%v': %w", projectFullPath, ErrProjectNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("GetProtectedBranches() failed listing the protected branches of project '%v': %w", projectFullPath, err)
+	}
+	err = json.Unmarshal(jsonResponse, &protectedBranches)
+	if err != nil {
+		return nil, fmt.Errorf("GetProtectedBranches() could not decode JSON response '%v' for project '%v': %w",
+			string(jsonResponse), projectFullPath, err)
+	}
+	return protectedBranches, nil
+}
+
+// Return the protected branches whose names match the branch, the same way as GitLab: either the exact name, or
+// a wildcard name where each "*" matches any characters, including "/" (ex: "release/*" matches "release/1.0").
+func MatchingProtectedBranches(protectedBranches []ProtectedBranch, branch string) (matching []ProtectedBranch) {
+	for _, protectedBranch := range protectedBranches {
+		if matchesWildcard(protectedBranch.Name, branch) {
+			matching = append(matching, protectedBranch)
+		}
 	}
 	return
 }
 
+// Return whether the name matches the wildcard pattern, where each "*" matches any characters (or none), and
+// everything else is matched literally
+func matchesWildcard(pattern string, name string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == name
+	}
+	// The first part must be at the start, the last part at the end, and the rest in order in between
+	if !strings.HasPrefix(name, parts[0]) || !strings.HasSuffix(name[len(parts[0]):], parts[len(parts)-1]) {
+		return false
+	}
+	middle := name[len(parts[0]) : len(name)-len(parts[len(parts)-1])]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(middle, part)
+		if i == -1 {
+			return false
+		}
+		middle = middle[i+len(part):]
+	}
+	return true
+}
+
+// Look up a merge request of the specified project by its IID (the "!123" number, rather than its global ID)
+func (server Server) GetMergeRequest(projectFullPath string, mergeRequestIid int) (mergeRequest *MergeRequest, err error) {
+	projectFullPath = strings.Trim(projectFullPath, "/")
+	endpointPath := "/projects/" + neturl.PathEscape(projectFullPath) +
+		"/merge_requests/" + strconv.Itoa(mergeRequestIid)
+	_, jsonResponse, err := server.RestRequest(endpointPath, "GET", "")
+	if err != nil {
+		err = fmt.Errorf("GetMergeRequest() failed looking up merge request !%d of project '%v': %w", mergeRequestIid, projectFullPath, err)
+		return nil, err
+	}
+	err = json.Unmarshal(jsonResponse, &mergeRequest)
+	if err != nil {
+		err = fmt.Errorf("GetMergeRequest() could not decode JSON response '%v' when looking up merge request !%d of project '%v': %w",
+			string(jsonResponse), mergeRequestIid, projectFullPath, err)
+		return nil, err
+	}
+	return mergeRequest, nil
+}
+
+// Look up a group by its full path (ex: my-group/my-subgroup). If there is no group with the specified path
+// that is visible to the server.GitlabToken identity, then the "group" return will be nil. Note that GitLab
+// redirects the old paths of renamed/moved groups, so the returned group's FullPath may differ from the
+// requested path.
+func (server Server) GetGroupByPath(groupFullPath string) (group *GroupDetails, err error) {
+	groupFullPath = strings.Trim(groupFullPath, "/")
+	endpointPath := "/groups/" + neturl.PathEscape(groupFullPath)
+	statusCode, jsonResponse, err := server.RestRequest(endpointPath, "GET", "")
+	if statusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		err = fmt.Errorf("GetGroupByPath() failed looking up group path '%v': %w", groupFullPath, err)
+		return nil, err
+	}
+	err = json.Unmarshal(jsonResponse, &group)
+	if err != nil {
+		err = fmt.Errorf("GetGroupByPath() could not decode JSON response '%v' when looking up group path '%v': %w",
+			string(jsonResponse), groupFullPath, err)
+		return nil, err
+	}
+	return group, nil
+}
+
+// Preflight check that the server.GitlabToken is valid and can read the specified project. Without this, a
+// token with too little scope or role just sees empty member lists, so every owner is reported as not found.
+// Returns the identity that the token belongs to.
+func (server Server) CheckTokenAccess(projectFullPath string) (user *User, err error) {
+	projectFullPath = strings.Trim(projectFullPath, "/")
+	statusCode, jsonResponse, err := server.RestRequest("/user", "GET", "")
+	if statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden {
+		err = fmt.Errorf("CheckTokenAccess() the token was rejected by GitLab (status %d), check that it is valid, "+
+			"has not expired, and has the 'read_api' scope", statusCode)
+		return nil, err
+	}
+	if err != nil {
+		err = fmt.Errorf("CheckTokenAccess() failed looking up the token's user: %w", err)
+		return nil, err
+	}
+	err = json.Unmarshal(jsonResponse, &user)
+	if err != nil {
+		err = fmt.Errorf("CheckTokenAccess() could not decode JSON response '%v' when looking up the token's user: %w",
+			string(jsonResponse), err)
+		return nil, err
+	}
+	endpointPath := "/projects/" + neturl.PathEscape(projectFullPath)
+	statusCode, _, err = server.RestRequest(endpointPath, "GET", "")
+	if statusCode == http.StatusNotFound || statusCode == http.StatusForbidden {
+		err = fmt.Errorf("CheckTokenAccess() token for user '%v' cannot access project '%v' (%w), check the token's "+
+			"scope (read_api) and the user's role in the project", user.Username, projectFullPath, ErrProjectNotFound)
+		return nil, err
+	}
+	if err != nil {
+		err = fmt.Errorf("CheckTokenAccess() failed looking up project '%v': %w", projectFullPath, err)
+		return nil, err
+	}
+	return user, nil
+}
+
+// Return the version of the GitLab instance. This is a cheap request to check that the REST API is reachable,
+// and since it requires authentication, that GitLab accepts the server.GitlabToken. Returns
+// transport.ErrTokenRejected (wrapped) if GitLab rejected the token.
+func (server Server) GetVersion() (version *Version, err error) {
+	statusCode, jsonResponse, err := server.RestRequest("/version", "GET", "")
+	if statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden {
+		return nil, fmt.Errorf("GetVersion() got status %d: %w", statusCode, transport.ErrTokenRejected)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("GetVersion() failed: %w", err)
+	}
+	err = json.Unmarshal(jsonResponse, &version)
+	if err != nil {
+		return nil, fmt.Errorf("GetVersion() could not decode JSON response '%v': %w", string(jsonResponse), err)
+	}
+	return version, nil
+}
+
 // Look up a project by its full path (ex: my-group/my-subgroup/my-project). If there is no project with the
 // specified path that is visible to the server.GitlabToken identity, then the "project" return will be nil.
 // Note: in order for project to be allowed to be nil, I had to make it a pointer.
@@ -37,20 +277,30 @@ func (server Server) GetProjectByPath(projectFullPath string) (project *Project,
 	if !strings.Contains(projectFullPath, "/") {
 		panic("GetProjectByPath() requires a path in the format of group/project or group/subgroup/project, invalid path: '" + projectFullPath + "'")
 	}
+	if cached, found := server.ProjectCache.get(projectFullPath); found {
+		slog.Debug("GetProjectByPath(): using the cached lookup of project path '" + projectFullPath + "'")
+		return cached, nil
+	}
 	// URL-encode the slashes in the group path
-	endpointPath := "/projects/" + strings.Replace(projectFullPath, "/", "%2F", -1)
-	// Make the REST request
-	_, jsonResponse, err := server.RestRequest(endpointPath, "GET", "")
+	endpointPath := "/projects/" + neturl.PathEscape(projectFullPath)
+	// Make the REST request. A 404 just means that the project isn't visible, so it isn't an error.
+	statusCode, jsonResponse, err := server.RestRequest(endpointPath, "GET", "")
+	if statusCode == http.StatusNotFound {
+		slog.Debug("GetProjectByPath(): project path '" + projectFullPath + "' was not found")
+		server.ProjectCache.set(projectFullPath, nil)
+		return nil, nil
+	}
 	if err != nil {
-		err = fmt.Errorf("GetProjectById() failed looking up project path '%v': %w", projectFullPath, err)
+		err = fmt.Errorf("GetProjectByPath() failed looking up project path '%v': %w", projectFullPath, err)
 		return nil, err
 	}
 	err = json.Unmarshal(jsonResponse, &project)
 	if err != nil {
-		err = fmt.Errorf("GetProjectById() could not decode JSON response '%v' when looking up project path '%v': %w",
+		err = fmt.Errorf("GetProjectByPath() could not decode JSON response '%v' when looking up project path '%v': %w",
 			string(jsonResponse), projectFullPath, err)
 		return nil, err
 	}
+	server.ProjectCache.set(projectFullPath, project)
 	return project, nil
 }
 
@@ -72,6 +322,21 @@ func (server Server) GetProjectById(id int) (project *Project, err error) {
 	return project, nil
 }
 
+// Send the request with the server's tokens, extra headers, and rate limit. See transport.DoWithFallbackToken().
+func (server Server) doWithFallbackToken(client Doer, req *http.Request) (*http.Response, error) {
+	return transport.DoWithFallbackToken(client, req, transport.Auth{Token: server.GitlabToken,
+		FallbackToken: server.FallbackToken, ExtraHeaders: server.ExtraHeaders, RateLimiter: server.RateLimiter})
+}
+
+// Return the server's HTTP client. Uses server.Client if it was set (ex: the shared, pooled client from
+// SetupGitlabConnections() or a mock), otherwise builds a client with the server's Timeout and Transport.
+func (server Server) httpClient() Doer {
+	if server.Client != nil {
+		return server.Client
+	}
+	return transport.NewClient(server.Transport, server.Timeout)
+}
+
 // Make the specified request against the GitLab server's REST API. Returns the API's response as
 // a raw (JSON) byte slice, so that the calling function can decode it to its expected type.
 func (server Server) RestRequest(path string, method string, jsonPayload string) (
@@ -80,6 +345,81 @@ func (server Server) RestRequest(path string, method string, jsonPayload string)
 	err error,
 ) {
 	endpointUrl := strings.TrimSuffix(server.RestUrl, "/") + "/" + strings.TrimPrefix(path, "/")
+	statusCode, jsonResponse, _, err = server.restRequestUrl(endpointUrl, method, jsonPayload)
+	return
+}
+
+// Make a GET request against the GitLab server's REST API for a list of resources, and follow the RFC 5988
+// 'Link: <url>; rel="next"' headers to read every page of the list. Returns all the pages' JSON arrays
+// concatenated into a single JSON array. Use RestRequest() for single resources.
+func (server Server) RestRequestAllPages(path string) (statusCode int, jsonResponse []byte, err error) {
+	endpointUrl := strings.TrimSuffix(server.RestUrl, "/") + "/" + strings.TrimPrefix(path, "/")
+	allItems := []json.RawMessage{}
+	for endpointUrl != "" {
+		var pageResponse []byte
+		var header http.Header
+		statusCode, pageResponse, header, err = server.restRequestUrl(endpointUrl, "GET", "")
+		if err != nil {
+			return
+		}
+		var pageItems []json.RawMessage
+		err = json.Unmarshal(pageResponse, &pageItems)
+		if err != nil {
+			err = fmt.Errorf("RestRequestAllPages() could not decode JSON array '%v' from '%v': %w", string(pageResponse), endpointUrl, err)
+			return
+		}
+		allItems = append(allItems, pageItems...)
+		endpointUrl = parseNextLink(header.Get("Link"))
+		// The next page is requested with the token, so it must be on the same GitLab server
+		if endpointUrl != "" && !sameOrigin(endpointUrl, server.RestUrl) {
+			err = fmt.Errorf("RestRequestAllPages() refused to follow the next page link '%v', since it's not on the same host as '%v'",
+				endpointUrl, server.RestUrl)
+			return
+		}
+	}
+	jsonResponse, err = json.Marshal(allItems)
+	return
+}
+
+// Return the URL of the next page from an RFC 5988 Link header, ex:
+// <https://gitlab.com/api/v4/projects/1/members?page=2&per_page=100>; rel="next", <...>; rel="last"
+// Returns "" if there is no next page.
+func parseNextLink(linkHeader string) (nextUrl string) {
+	for _, link := range strings.Split(linkHeader, ",") {
+		urlPart, params, found := strings.Cut(link, ";")
+		if !found {
+			continue
+		}
+		for _, param := range strings.Split(params, ";") {
+			if strings.ReplaceAll(strings.TrimSpace(param), " ", "") == `rel="next"` {
+				return strings.Trim(strings.TrimSpace(urlPart), "<>")
+			}
+		}
+	}
+	return ""
+}
+
+// Return whether both URLs have the same scheme and host (including the port). Hosts are case-insensitive.
+func sameOrigin(url string, otherUrl string) bool {
+	u, err := neturl.Parse(url)
+	if err != nil {
+		return false
+	}
+	other, err := neturl.Parse(otherUrl)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Scheme, other.Scheme) && strings.EqualFold(u.Host, other.Host)
+}
+
+// Make the specified request against the full URL of a REST API endpoint. Also returns the response's
+// headers, ex: for pagination.
+func (server Server) restRequestUrl(endpointUrl string, method string, jsonPayload string) (
+	statusCode int,
+	jsonResponse []byte,
+	header http.Header,
+	err error,
+) {
 	err = validateUrlWithPath(endpointUrl)
 	if err != nil {
 		return
@@ -89,31 +429,36 @@ func (server Server) RestRequest(path string, method string, jsonPayload string)
 		return
 	}
 	// Setup the request
-	client := &http.Client{
-		Timeout: time.Second * time.Duration(server.Timeout),
+	client := server.httpClient()
+	ctx := server.Context
+	if ctx == nil {
+		ctx = context.Background()
 	}
-	req, err := http.NewRequest(method, endpointUrl, strings.NewReader(jsonPayload))
+	req, err := http.NewRequestWithContext(ctx, method, endpointUrl, strings.NewReader(jsonPayload))
 	if err != nil {
 		err = fmt.Errorf("error trying to create REST request to '%v' with payload '%v': '%w'", endpointUrl, jsonPayload, err)
 		return
 	}
 	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Authorization", "Bearer "+server.GitlabToken)
 	// Make the request
-	slog.Debug("Making HTTP request:", slog.Any("httpRequest", req))
-	res, err := client.Do(req)
+	res, err := server.doWithFallbackToken(client, req)
 	if err != nil {
 		err = fmt.Errorf("error making REST request to '%v' with payload '%v': '%w'", endpointUrl, jsonPayload, err)
 		return
 	}
 	// Return the results
 	statusCode = res.StatusCode
+	header = res.Header
 	defer res.Body.Close()
 	jsonResponse, err = io.ReadAll(res.Body)
 	if err != nil {
 		err = fmt.Errorf("error reading response from request '%v' with payload '%v': '%w'", endpointUrl, jsonPayload, err)
 		return
 	}
+	err = transport.CheckForNonJsonResponse(res, jsonResponse)
+	if err != nil {
+		return
+	}
 	slog.Debug("HTTP response received:", slog.Any(fmt.Sprint(res.StatusCode), jsonResponse))
 	if res.StatusCode != http.StatusOK {
 		err = fmt.Errorf("request '%v' with payload '%v' returned status %d and response '%v'", endpointUrl, jsonPayload, res.StatusCode, string(jsonResponse))
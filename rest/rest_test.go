@@ -0,0 +1,119 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRestRequestAllPagesRefusesCrossHostLink(t *testing.T) {
+	var otherHostHits atomic.Int32
+	otherHost := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		otherHostHits.Add(1)
+		fmt.Fprint(w, "[]")
+	}))
+	defer otherHost.Close()
+	gitlab := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", fmt.Sprintf(`<%v/api/v4/projects/1/members?page=2>; rel="next"`, otherHost.URL))
+		fmt.Fprint(w, `[{"id": 1, "username": "alice"}]`)
+	}))
+	defer gitlab.Close()
+
+	server := Server{RestUrl: gitlab.URL + "/api/v4", GitlabToken: "secret", FallbackToken: "fallback", Timeout: 5}
+	_, _, err := server.RestRequestAllPages("projects/1/members")
+	if err == nil || !strings.Contains(err.Error(), "refused to follow") {
+		t.Errorf("RestRequestAllPages() error = %v, want it to refuse the cross-host link", err)
+	}
+	if hits := otherHostHits.Load(); hits != 0 {
+		t.Errorf("the other host got %d requests, want 0, since they'd include the token", hits)
+	}
+}
+
+func TestRestRequestAllPagesFollowsSameHostLink(t *testing.T) {
+	var gitlab *httptest.Server
+	gitlab = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "2" {
+			fmt.Fprint(w, `[{"id": 2}]`)
+			return
+		}
+		w.Header().Set("Link", fmt.Sprintf(`<%v/api/v4/items?page=2>; rel="next"`, gitlab.URL))
+		fmt.Fprint(w, `[{"id": 1}]`)
+	}))
+	defer gitlab.Close()
+
+	server := Server{RestUrl: gitlab.URL + "/api/v4", GitlabToken: "secret", Timeout: 5}
+	_, jsonResponse, err := server.RestRequestAllPages("items")
+	if err != nil {
+		t.Fatalf("RestRequestAllPages() error = %v", err)
+	}
+	if got, want := string(jsonResponse), `[{"id":1},{"id":2}]`; got != want {
+		t.Errorf("RestRequestAllPages() = %v, want %v", got, want)
+	}
+}
+
+func TestSameOrigin(t *testing.T) {
+	tests := []struct {
+		url      string
+		otherUrl string
+		want     bool
+	}{
+		{"https://gitlab.example.com/api/v4/x?page=2", "https://gitlab.example.com/api/v4", true},
+		{"https://GitLab.example.com/api/v4/x", "https://gitlab.example.com/api/v4", true},
+		{"https://evil.example.com/api/v4/x", "https://gitlab.example.com/api/v4", false},
+		{"http://gitlab.example.com/api/v4/x", "https://gitlab.example.com/api/v4", false},
+		{"https://gitlab.example.com:8443/api/v4/x", "https://gitlab.example.com/api/v4", false},
+		{"https://gitlab.example.com@evil.example.com/x", "https://gitlab.example.com/api/v4", false},
+		{"/api/v4/x", "https://gitlab.example.com/api/v4", false},
+	}
+	for _, tt := range tests {
+		if got := sameOrigin(tt.url, tt.otherUrl); got != tt.want {
+			t.Errorf("sameOrigin(%q, %q) = %v, want %v", tt.url, tt.otherUrl, got, tt.want)
+		}
+	}
+}
+
+func TestMatchesWildcard(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{"main", "main", true},
+		{"main", "main2", false},
+		{"release/*", "release/1.0", true},
+		{"release/*", "release/1.0/hotfix", true},
+		{"release/*", "release/", true},
+		{"release/*", "releases/1.0", false},
+		{"*-stable", "17-5-stable", true},
+		{"*-stable", "17-5-stable-old", false},
+		{"*", "anything/at/all", true},
+		{"feature/*/ready", "feature/x/y/ready", true},
+		{"feature/*/ready", "feature/ready", false},
+		{"a*b*c", "abc", true},
+		{"a*b*c", "acb", false},
+		{"v1.*", "v1x2", false},
+	}
+	for _, tt := range tests {
+		if got := matchesWildcard(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("matchesWildcard(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGetProjectByPathReportsFailures(t *testing.T) {
+	gitlab := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, `{"message": "500 Internal Server Error"}`)
+	}))
+	defer gitlab.Close()
+
+	// Unlike a 404, which is a nil project, any other failure is an error
+	server := Server{RestUrl: gitlab.URL + "/api/v4", GitlabToken: "secret", Timeout: 5}
+	project, err := server.GetProjectByPath("my-group/my-project")
+	if err == nil || project != nil {
+		t.Errorf("GetProjectByPath() = %+v, %v, want an error", project, err)
+	}
+}
@@ -1,9 +1,40 @@
 package rest
 
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"gitlab.com/tedspinks/validate-codeowners/ratelimit"
+	"gitlab.com/tedspinks/validate-codeowners/transport"
+)
+
+// Connection settings for GitLab's REST API. The methods don't change the Server, and its optional RateLimiter
+// and ProjectCache are safe to share, so one Server can be used by concurrent goroutines (ex: several validations).
 type Server struct {
-	RestUrl     string // HTTPS URL for your GitLab instance's REST API.
-	GitlabToken string // GitLab token for connecting to the REST API (scope=read_api, role=Developer)
-	Timeout     int    // Timeout for REST requests, in seconds
+	RestUrl       string             // HTTPS URL for your GitLab instance's REST API.
+	GitlabToken   string             // GitLab token for connecting to the REST API (scope=read_api, role=Developer)
+	FallbackToken string             // Optional token to retry a request with, once, if GitLab rejects GitlabToken (401)
+	Timeout       int                // Timeout for REST requests, in seconds
+	Transport     http.RoundTripper  // Optional HTTP transport (ex: for a proxy). Go's default transport is used if nil.
+	Client        Doer               // Optional HTTP client (ex: a mock for testing). Built from Timeout and Transport if nil.
+	RateLimiter   *ratelimit.Limiter // Optional client-side rate limit. No limit if nil.
+	ExtraHeaders  http.Header        // Optional headers to add to every request, ex: for a gateway. Never logged.
+	Context       context.Context    // Optional context for every request, ex: with a deadline for a whole phase. Never canceled if nil.
+	ProjectCache  *ProjectCache      // Optional cache of GetProjectByPath() results. Nothing is cached if nil.
+}
+
+// Sends an HTTP request and returns its response. Satisfied by *http.Client, so that a mock can be injected
+// into Server.Client to test error handling without a real server.
+type Doer = transport.Doer
+
+// JSON documentation:
+// https://docs.gitlab.com/ee/api/users.html#list-current-user
+
+type User struct {
+	Id       int    `json:"id"`
+	Username string `json:"username"`
+	IsAdmin  bool   `json:"is_admin"`
 }
 
 // JSON documentation:
@@ -21,3 +52,81 @@ type Group struct {
 	GroupFullPath    string `json:"group_full_path"`
 	GroupAccessLevel int    `json:"group_access_level"`
 }
+
+// Access levels of GitLab's roles, ex: for Group.GroupAccessLevel. Developer is the lowest role that can
+// approve merge requests.
+const (
+	GuestAccess      = 10
+	ReporterAccess   = 20
+	DeveloperAccess  = 30
+	MaintainerAccess = 40
+	OwnerAccess      = 50
+)
+
+// Return the name of the role with the specified access level, ex: "Reporter" for 20
+func AccessLevelName(accessLevel int) string {
+	switch accessLevel {
+	case GuestAccess:
+		return "Guest"
+	case ReporterAccess:
+		return "Reporter"
+	case DeveloperAccess:
+		return "Developer"
+	case MaintainerAccess:
+		return "Maintainer"
+	case OwnerAccess:
+		return "Owner"
+	}
+	return fmt.Sprintf("access level %d", accessLevel)
+}
+
+// JSON documentation:
+// https://docs.gitlab.com/ee/api/members.html#list-all-members-of-a-group-or-project
+
+type Member struct {
+	Id          int    `json:"id"`
+	Username    string `json:"username"`
+	Email       string `json:"email"`        // Only visible to admins, or to group owners for enterprise users
+	PublicEmail string `json:"public_email"` // Only set if the user made their email public
+}
+
+// JSON documentation:
+// https://docs.gitlab.com/ee/api/groups.html#details-of-a-group
+
+type GroupDetails struct {
+	Id       int    `json:"id"`
+	Name     string `json:"name"`
+	FullPath string `json:"full_path"`
+}
+
+// JSON documentation:
+// https://docs.gitlab.com/ee/api/version.html
+
+type Version struct {
+	Version  string `json:"version"` // ex: "17.5.0-ee"
+	Revision string `json:"revision"`
+}
+
+// JSON documentation:
+// https://docs.gitlab.com/ee/api/protected_branches.html#list-protected-branches
+
+type ProtectedBranch struct {
+	Id                        int    `json:"id"`
+	Name                      string `json:"name"` // The branch name, or a wildcard, ex: "release/*"
+	CodeOwnerApprovalRequired bool   `json:"code_owner_approval_required"`
+}
+
+// JSON documentation:
+// https://docs.gitlab.com/ee/api/merge_requests.html#get-single-mr
+
+type MergeRequest struct {
+	Iid          int    `json:"iid"`
+	SourceBranch string `json:"source_branch"`
+	TargetBranch string `json:"target_branch"`
+	Author       struct {
+		Username string `json:"username"`
+	} `json:"author"`
+	DiffRefs struct {
+		HeadSha string `json:"head_sha"`
+	} `json:"diff_refs"`
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestApplyTargetProject(t *testing.T) {
+	tests := []struct {
+		targetProject   string
+		wantProjectPath string
+		wantErr         string
+	}{
+		{"my-group/my-project", "my-group/my-project", ""},
+		{"/my-group/sub-group/my-project/", "my-group/sub-group/my-project", ""},
+		{"my-project", "", "must be the project's full path"},
+		{"/my-project/", "", "must be the project's full path"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.targetProject, func(t *testing.T) {
+			var eVars envVarArgs
+			eVars.TargetProject = tt.targetProject
+			eVars.CodeownersFile = "repo/CODEOWNERS"
+			eVars.DryRun = true
+			err := applyTargetProject(&eVars)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("applyTargetProject() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyTargetProject() error = %v", err)
+			}
+			if eVars.ProjectPath != tt.wantProjectPath {
+				t.Errorf("ProjectPath = %q, want %q", eVars.ProjectPath, tt.wantProjectPath)
+			}
+		})
+	}
+}
@@ -0,0 +1 @@
+Fixture file for the test-glob-translations job
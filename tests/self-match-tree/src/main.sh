@@ -0,0 +1,2 @@
+#!/bin/sh
+echo "Fixture for the test-exclude-self-match job"
@@ -0,0 +1,285 @@
+// This package provides a fake GitLab server, for testing the graphql, rest, and validate packages (or tools that
+// embed them) without a real GitLab instance. It answers the GraphQL queries and REST endpoints that those
+// packages use from canned data, and splits long lists into pages, so that pagination gets exercised too.
+package testutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gitlab.com/tedspinks/validate-codeowners/graphql"
+	"gitlab.com/tedspinks/validate-codeowners/rest"
+)
+
+// Canned data for the fake GitLab server. Set the fields before calling Start(), and don't change them while the
+// server is running, since requests are answered concurrently.
+type GitLab struct {
+	Projects      map[string]rest.Project              // By full path, ex: "my-group/my-project"
+	DirectMembers map[string][]rest.Member             // Project full path -> the users who are direct members of the project
+	GroupMembers  map[int][]rest.Member                // Group ID -> the group's members, including those inherited from parents
+	Groups        []rest.GroupDetails                  // Groups that exist, whether or not they're shared with a project
+	Users         []rest.Member                        // Users that exist, whether or not they're members of a project
+	TokenUser     rest.User                            // The user that the token belongs to, ex: for CheckTokenAccess()
+	Version       rest.Version                         // The GitLab version, ex: for GetVersion()
+	SyntaxErrors  map[string][]graphql.ValidationError // CODEOWNERS path -> its syntax errors. Other paths are valid.
+	PageSize      int                                  // Max items per page of members and users, 0 to return them all at once
+	// Project full path -> its protected branches, including wildcard ones (ex: "release/*")
+	ProtectedBranches map[string][]rest.ProtectedBranch
+
+	server *httptest.Server
+}
+
+// Start the fake server on a local port. Call Close() when done with it.
+func (g *GitLab) Start() {
+	g.server = httptest.NewServer(g)
+}
+
+// Stop the fake server
+func (g *GitLab) Close() {
+	g.server.Close()
+}
+
+// URL of the fake GraphQL API, ex: for graphql.Server.GraphQlUrl or validate.Config.GitlabGraphqlUrl
+func (g *GitLab) GraphQlUrl() string {
+	return g.server.URL + "/api/graphql"
+}
+
+// URL of the fake REST API, ex: for rest.Server.RestUrl or validate.Config.GitlabRestUrl
+func (g *GitLab) RestUrl() string {
+	return g.server.URL + "/api/v4"
+}
+
+// Answer a GraphQL or REST request from the canned data
+func (g *GitLab) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/api/graphql":
+		g.serveGraphQl(w, r)
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/api/v4/"):
+		g.serveRest(w, r)
+	default:
+		writeJson(w, http.StatusNotFound, map[string]any{"message": "404 Not Found"})
+	}
+}
+
+// Answer a GraphQL query, based on the field that it queries and its variables
+func (g *GitLab) serveGraphQl(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Query     string         `json:"query"`
+		Variables map[string]any `json:"variables"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		writeJson(w, http.StatusBadRequest, map[string]any{"errors": []map[string]any{{"message": err.Error()}}})
+		return
+	}
+	fullPath, _ := body.Variables["fullPath"].(string)
+	after, _ := body.Variables["after"].(string)
+	switch {
+	case strings.Contains(body.Query, "validateCodeownerFile"):
+		path, _ := body.Variables["path"].(string)
+		g.writeSyntaxErrors(w, path)
+	case strings.Contains(body.Query, "projectMembers"):
+		relations, _ := body.Variables["relations"].([]any)
+		var members []rest.Member
+		if slices.Contains(relations, any("INVITED_GROUPS")) {
+			members = g.invitedMembers(fullPath)
+		} else {
+			members = g.DirectMembers[fullPath]
+		}
+		page, pageInfo := paginate(members, after, g.PageSize)
+		writeJson(w, http.StatusOK, map[string]any{"data": map[string]any{"project": map[string]any{
+			"projectMembers": map[string]any{"pageInfo": pageInfo, "nodes": memberNodes(page)}}}})
+	case strings.Contains(body.Query, "users("):
+		usernames, _ := body.Variables["usernames"].([]any)
+		var users []rest.Member
+		for _, user := range g.Users {
+			if slices.Contains(usernames, any(user.Username)) {
+				users = append(users, user)
+			}
+		}
+		page, pageInfo := paginate(users, after, g.PageSize)
+		nodes := []map[string]any{}
+		for _, member := range memberNodes(page) {
+			nodes = append(nodes, member["user"].(map[string]any))
+		}
+		writeJson(w, http.StatusOK, map[string]any{"data": map[string]any{"users": map[string]any{
+			"pageInfo": pageInfo, "nodes": nodes}}})
+	case strings.Contains(body.Query, "currentUser"):
+		var currentUser map[string]any
+		if g.TokenUser.Username != "" {
+			currentUser = map[string]any{"username": g.TokenUser.Username}
+		}
+		writeJson(w, http.StatusOK, map[string]any{"data": map[string]any{"__typename": "Query", "currentUser": currentUser}})
+	case strings.Contains(body.Query, "descendantGroups"):
+		var group map[string]any
+		if g.findGroup(fullPath) != nil {
+			nodes := []map[string]any{}
+			for _, descendant := range g.Groups {
+				if strings.HasPrefix(descendant.FullPath, fullPath+"/") {
+					nodes = append(nodes, map[string]any{"fullPath": descendant.FullPath})
+				}
+			}
+			group = map[string]any{"descendantGroups": map[string]any{
+				"pageInfo": map[string]any{"startCursor": "", "endCursor": "", "hasNextPage": false}, "nodes": nodes}}
+		}
+		writeJson(w, http.StatusOK, map[string]any{"data": map[string]any{"group": group}})
+	case strings.Contains(body.Query, "group("):
+		var group *graphql.Group
+		if details := g.findGroup(fullPath); details != nil {
+			group = &graphql.Group{Id: fmt.Sprintf("gid://gitlab/Group/%d", details.Id), Name: details.Name,
+				Path: fullPath[strings.LastIndex(fullPath, "/")+1:], FullName: details.Name, FullPath: details.FullPath,
+				Visibility: "private"}
+		}
+		writeJson(w, http.StatusOK, map[string]any{"data": map[string]any{"group": group}})
+	default:
+		writeJson(w, http.StatusOK, map[string]any{"errors": []map[string]any{{"message": "testutil can't answer the query: " + body.Query}}})
+	}
+}
+
+// Answer a validateCodeownerFile query with the canned syntax errors for the path
+func (g *GitLab) writeSyntaxErrors(w http.ResponseWriter, path string) {
+	validationErrors := []map[string]any{}
+	for _, validationError := range g.SyntaxErrors[path] {
+		validationErrors = append(validationErrors, map[string]any{"code": validationError.Code, "lines": validationError.Lines})
+	}
+	writeJson(w, http.StatusOK, map[string]any{"data": map[string]any{"project": map[string]any{"repository": map[string]any{
+		"validateCodeownerFile": map[string]any{"total": len(validationErrors), "validationErrors": validationErrors}}}}})
+}
+
+// Answer a REST request. GitLab paths can be URL-encoded in place of an ID, ex: /projects/my-group%2Fmy-project
+func (g *GitLab) serveRest(w http.ResponseWriter, r *http.Request) {
+	var segments []string
+	for _, segment := range strings.Split(strings.TrimPrefix(r.URL.EscapedPath(), "/api/v4/"), "/") {
+		unescaped, err := url.PathUnescape(segment)
+		if err != nil {
+			writeJson(w, http.StatusBadRequest, map[string]any{"message": err.Error()})
+			return
+		}
+		segments = append(segments, unescaped)
+	}
+	notFound := map[string]any{"message": "404 Not Found"}
+	switch {
+	case len(segments) == 1 && segments[0] == "user":
+		writeJson(w, http.StatusOK, g.TokenUser)
+	case len(segments) == 1 && segments[0] == "version":
+		writeJson(w, http.StatusOK, g.Version)
+	case len(segments) == 2 && segments[0] == "projects":
+		project, found := g.Projects[segments[1]]
+		if !found {
+			writeJson(w, http.StatusNotFound, notFound)
+			return
+		}
+		writeJson(w, http.StatusOK, project)
+	case len(segments) == 3 && segments[0] == "projects" && segments[2] == "members":
+		if _, found := g.Projects[segments[1]]; !found {
+			writeJson(w, http.StatusNotFound, notFound)
+			return
+		}
+		g.writeRestPage(w, r, g.DirectMembers[segments[1]])
+	case len(segments) == 3 && segments[0] == "projects" && segments[2] == "protected_branches":
+		if _, found := g.Projects[segments[1]]; !found {
+			writeJson(w, http.StatusNotFound, notFound)
+			return
+		}
+		writeJson(w, http.StatusOK, append([]rest.ProtectedBranch{}, g.ProtectedBranches[segments[1]]...))
+	case len(segments) == 4 && segments[0] == "groups" && segments[2] == "members" && segments[3] == "all":
+		groupId, err := strconv.Atoi(segments[1])
+		if err != nil {
+			writeJson(w, http.StatusNotFound, notFound)
+			return
+		}
+		g.writeRestPage(w, r, g.GroupMembers[groupId])
+	case len(segments) == 2 && segments[0] == "groups":
+		group := g.findGroup(segments[1])
+		if group == nil {
+			writeJson(w, http.StatusNotFound, notFound)
+			return
+		}
+		writeJson(w, http.StatusOK, group)
+	default:
+		writeJson(w, http.StatusNotFound, notFound)
+	}
+}
+
+// Write one page of members, with a Link header to the next page (if any), the same way as GitLab
+func (g *GitLab) writeRestPage(w http.ResponseWriter, r *http.Request, members []rest.Member) {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	page = max(page, 1)
+	pageSize := len(members)
+	if g.PageSize > 0 {
+		pageSize = g.PageSize
+	}
+	start := min((page-1)*pageSize, len(members))
+	end := min(start+pageSize, len(members))
+	if end < len(members) {
+		query := r.URL.Query()
+		query.Set("page", strconv.Itoa(page+1))
+		w.Header().Set("Link", fmt.Sprintf(`<%v%v?%v>; rel="next"`, g.server.URL, r.URL.EscapedPath(), query.Encode()))
+	}
+	writeJson(w, http.StatusOK, append([]rest.Member{}, members[start:end]...))
+}
+
+// Return the members of all the groups that the project is shared with
+func (g *GitLab) invitedMembers(projectFullPath string) (members []rest.Member) {
+	for _, group := range g.Projects[projectFullPath].SharedWithGroups {
+		members = append(members, g.GroupMembers[group.GroupId]...)
+	}
+	return
+}
+
+// Return the group with the full path, or nil if there isn't one
+func (g *GitLab) findGroup(fullPath string) *rest.GroupDetails {
+	for i, group := range g.Groups {
+		if group.FullPath == fullPath {
+			return &g.Groups[i]
+		}
+	}
+	return nil
+}
+
+// Return the page of items that starts at the cursor (the index of its first item, or "" for the first page),
+// along with GraphQL's pageInfo for it
+func paginate(items []rest.Member, cursor string, pageSize int) (page []rest.Member, pageInfo map[string]any) {
+	start, _ := strconv.Atoi(cursor)
+	start = min(max(start, 0), len(items))
+	end := len(items)
+	if pageSize > 0 {
+		end = min(start+pageSize, len(items))
+	}
+	pageInfo = map[string]any{"startCursor": strconv.Itoa(start), "endCursor": strconv.Itoa(end), "hasNextPage": end < len(items)}
+	return items[start:end], pageInfo
+}
+
+// Return the members as GraphQL projectMembers nodes
+func memberNodes(members []rest.Member) (nodes []map[string]any) {
+	nodes = []map[string]any{}
+	for _, member := range members {
+		emails := []map[string]any{}
+		if member.Email != "" {
+			emails = append(emails, map[string]any{"email": member.Email})
+		}
+		user := map[string]any{"id": fmt.Sprintf("gid://gitlab/User/%d", member.Id), "username": member.Username,
+			"publicEmail": member.PublicEmail, "emails": map[string]any{"nodes": emails}}
+		nodes = append(nodes, map[string]any{"id": fmt.Sprintf("gid://gitlab/ProjectMember/%d", member.Id), "user": user})
+	}
+	return
+}
+
+// Write the body as JSON. It's encoded before anything is written, so that an encoding error can still be returned
+// as a 500, which fails the request under test instead of handing it a truncated body.
+func writeJson(w http.ResponseWriter, statusCode int, body any) {
+	bodyJson, err := json.Marshal(body)
+	if err != nil {
+		http.Error(w, "testutil can't encode the response as JSON: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(bodyJson)
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Set by CODEOWNERS_TIMINGS, to print a summary of how long each phase of the run took
+var showTimings bool
+
+// When the run started, for the total duration
+var runStart time.Time
+
+// Print a table of the report's phase timings, if CODEOWNERS_TIMINGS is enabled
+func printTimings() {
+	if !showTimings || len(report.Timings) == 0 {
+		return
+	}
+	width := len("Total")
+	for _, t := range report.Timings {
+		width = max(width, len(t.Phase))
+	}
+	fmt.Println("\nTimings:")
+	for _, t := range report.Timings {
+		fmt.Printf("     %-*v  %v\n", width, t.Phase, t.Duration.Round(time.Millisecond))
+	}
+	fmt.Printf("     %-*v  %v\n", width, "Total", time.Since(runStart).Round(time.Millisecond))
+}
@@ -0,0 +1,78 @@
+package transport
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+
+	"gitlab.com/tedspinks/validate-codeowners/ratelimit"
+)
+
+// Returned (wrapped) by the graphql and rest packages' connection checks, ex: graphql's Ping() and rest's
+// GetVersion(), when GitLab rejects the token (and the fallback token, if it's set)
+var ErrTokenRejected = errors.New("gitlab rejected the token")
+
+// Sends an HTTP request and returns its response. Satisfied by *http.Client, so that a mock can be injected
+// to test error handling without a real server.
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// How a request to GitLab is authenticated, and the headers and rate limit that it's sent with
+type Auth struct {
+	Token         string             // GitLab token, sent as a Bearer token
+	FallbackToken string             // Optional token to retry a request with, once, if GitLab rejects Token (401)
+	ExtraHeaders  http.Header        // Optional headers to add to every request, ex: for a gateway. Never logged.
+	RateLimiter   *ratelimit.Limiter // Optional client-side rate limit. No limit if nil.
+}
+
+// Send the request with auth.Token. If GitLab rejects the token (401) and auth.FallbackToken is set, then the
+// request is retried once with the fallback token, ex: while the primary token is being rotated.
+func DoWithFallbackToken(client Doer, req *http.Request, auth Auth) (res *http.Response, err error) {
+	for key, values := range auth.ExtraHeaders {
+		// Copied, so that concurrent requests never share (or append to) the caller's slices
+		req.Header[key] = slices.Clone(values)
+	}
+	// Set after the extra headers, so that they can't replace the token
+	req.Header.Set("Authorization", "Bearer "+auth.Token)
+	// Only log the method and URL, since the headers include the token
+	slog.Debug("Making HTTP request:", "method", req.Method, "url", req.URL.String())
+	auth.RateLimiter.Wait()
+	res, err = client.Do(req)
+	if err != nil || res.StatusCode != http.StatusUnauthorized || auth.FallbackToken == "" {
+		return
+	}
+	res.Body.Close()
+	slog.Debug("The primary token was rejected (401), so retrying once with the fallback token", "url", req.URL.String())
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		retry.Body, err = req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+	}
+	retry.Header.Set("Authorization", "Bearer "+auth.FallbackToken)
+	auth.RateLimiter.Wait()
+	res, err = client.Do(retry)
+	if err == nil {
+		slog.Debug(fmt.Sprintf("The request with the fallback token returned status %d", res.StatusCode), "url", req.URL.String())
+	}
+	return
+}
+
+// Return an error if the response isn't JSON, ex: GitLab's HTML 503 page while it's in maintenance mode, which
+// would otherwise fail with a cryptic JSON parse error. Only the first chunk of the body is logged, at debug level.
+func CheckForNonJsonResponse(res *http.Response, body []byte) error {
+	mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	isJsonType := mediaType == "" || strings.Contains(mediaType, "json")
+	if len(body) == 0 || json.Valid(body) || (isJsonType && res.StatusCode == http.StatusOK) {
+		return nil
+	}
+	slog.Debug("Non-JSON response received:", "status", res.StatusCode, "contentType", mediaType, "bodyStart", string(body[:min(len(body), 500)]))
+	return fmt.Errorf("GitLab returned a non-JSON response (status %d), it may be in maintenance", res.StatusCode)
+}
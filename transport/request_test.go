@@ -0,0 +1,67 @@
+package transport
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDoWithFallbackToken(t *testing.T) {
+	var tokens []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokens = append(tokens, r.Header.Get("Authorization"))
+		if r.Header.Get("Authorization") != "Bearer fallback" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name          string
+		auth          Auth
+		wantStatus    int
+		wantTokensLen int
+	}{
+		{"retried with the fallback token", Auth{Token: "primary", FallbackToken: "fallback"}, http.StatusOK, 2},
+		{"no fallback token", Auth{Token: "primary"}, http.StatusUnauthorized, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens = nil
+			req, _ := http.NewRequest(http.MethodPost, server.URL, strings.NewReader("{}"))
+			res, err := DoWithFallbackToken(server.Client(), req, tt.auth)
+			if err != nil {
+				t.Fatalf("DoWithFallbackToken() error = %v", err)
+			}
+			res.Body.Close()
+			if res.StatusCode != tt.wantStatus || len(tokens) != tt.wantTokensLen {
+				t.Errorf("DoWithFallbackToken() status = %d after tokens %v, want %d after %d requests",
+					res.StatusCode, tokens, tt.wantStatus, tt.wantTokensLen)
+			}
+		})
+	}
+}
+
+func TestCheckForNonJsonResponse(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		contentType string
+		body        string
+		wantErr     bool
+	}{
+		{"JSON", http.StatusOK, "application/json", `{"data": {}}`, false},
+		{"JSON error status", http.StatusNotFound, "application/json", `{"message": "404 Not Found"}`, false},
+		{"empty body", http.StatusServiceUnavailable, "text/html", "", false},
+		{"maintenance page", http.StatusServiceUnavailable, "text/html; charset=utf-8", "<html>Maintenance</html>", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := &http.Response{StatusCode: tt.status, Header: http.Header{"Content-Type": {tt.contentType}}}
+			if err := CheckForNonJsonResponse(res, []byte(tt.body)); (err != nil) != tt.wantErr {
+				t.Errorf("CheckForNonJsonResponse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+// This package builds the HTTP transport that is shared by the graphql and rest packages, and sends their
+// requests, so that both of the GitLab APIs are reached the same way (ex: through the same proxy, with the same
+// tokens).
+package transport
+
+import (
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"time"
+)
+
+// Connection pool settings. The tool makes many small requests to the same GitLab host (ex: one per page of
+// members), so more idle connections are kept per host than Go's default of 2, to avoid new TLS handshakes.
+const (
+	maxIdleConnsPerHost = 16
+	idleConnTimeout     = 90 * time.Second
+)
+
+// Return an HTTP transport that sends requests through the proxy at proxyUrl. If proxyUrl is empty, then the
+// standard HTTP_PROXY, HTTPS_PROXY, and NO_PROXY environment variables are honored instead.
+func New(proxyUrl string) (*http.Transport, error) {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = http.ProxyFromEnvironment
+	t.MaxIdleConnsPerHost = maxIdleConnsPerHost
+	t.IdleConnTimeout = idleConnTimeout
+	if proxyUrl == "" {
+		return t, nil
+	}
+	u, err := neturl.Parse(proxyUrl)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse proxy URL '%v': %w", proxyUrl, err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL '%v'", proxyUrl)
+	}
+	t.Proxy = http.ProxyURL(u)
+	return t, nil
+}
+
+// Return an HTTP client that sends requests through t, so that its pooled (keep-alive) connections are reused
+// across requests. The timeout applies to each request separately, including reading its response body.
+func NewClient(t http.RoundTripper, timeoutSecs int) *http.Client {
+	return &http.Client{
+		Timeout:   time.Second * time.Duration(timeoutSecs),
+		Transport: t,
+	}
+}
+
+// Parse extra request headers from comma-separated "Key:Value" pairs, ex: "X-Gateway-Token:abc123,X-Team:platform",
+// for a GitLab that sits behind a gateway. The Authorization header can't be set this way, since it's always
+// set from the GitLab token. Header values are never included in the errors, since they may be secrets.
+func ParseHeaders(headers string) (http.Header, error) {
+	return parseHeaders(headers, false)
+}
+
+// Same as ParseHeaders(), but for a webhook, ex: "Authorization:Bearer abc123,X-Source:codeowners". Authorization
+// can be set, since a webhook isn't sent the GitLab token.
+func ParseWebhookHeaders(headers string) (http.Header, error) {
+	return parseHeaders(headers, true)
+}
+
+func parseHeaders(headers string, allowAuthorization bool) (http.Header, error) {
+	parsed := http.Header{}
+	for i, pair := range strings.Split(headers, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		key, value, found := strings.Cut(pair, ":")
+		key = strings.TrimSpace(key)
+		if !found || key == "" {
+			return nil, fmt.Errorf("header #%d must be in the format Key:Value", i+1)
+		}
+		if strings.EqualFold(key, "Authorization") && !allowAuthorization {
+			return nil, fmt.Errorf("header '%v' can't be set this way, since it's set from the GitLab token", key)
+		}
+		parsed.Add(key, strings.TrimSpace(value))
+	}
+	return parsed, nil
+}
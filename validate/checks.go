@@ -0,0 +1,1132 @@
+package validate
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bmatcuk/doublestar" // because Glob() in "path/filepath" doesn't support "**"
+	"gitlab.com/tedspinks/validate-codeowners/analysis"
+	"gitlab.com/tedspinks/validate-codeowners/graphql"
+	"gitlab.com/tedspinks/validate-codeowners/rest"
+)
+
+// Escapes the special characters of a doublestar glob expression
+var globEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "{", `\{`)
+
+// Returns true if the token can access the project. The result is only recorded in the report if the check
+// fails, so that the normal output isn't cluttered by a preflight check.
+func (v *validator) checkTokenAccess(tChecker tokenChecker, projectPath string) (passed bool) {
+	user, err := tChecker.CheckTokenAccess(projectPath)
+	if err != nil {
+		return v.recordResults("Token access check", ExitCodeInternal, err, nil, "")
+	}
+	slog.Debug("Token access check passed", "user", user.Username, "admin", user.IsAdmin, "project", projectPath)
+	v.tokenIsAdmin = user.IsAdmin
+	return true
+}
+
+// Return the ref to check the syntax on, and the branch that the CODEOWNERS file will be enforced on. For a
+// merge request (mergeRequestIid > 0), these are the merge request's head commit (which is also visible in the
+// target project, unlike a fork's source branch) and its target branch, along with the merge request's author.
+// Otherwise, they're both the branch, and the author is "".
+func resolveMergeRequestRefs(mChecker mergeRequestChecker, projectFullPath string, mergeRequestIid int, branch string) (
+	syntaxRef string,
+	targetBranch string,
+	author string,
+	err error,
+) {
+	if mergeRequestIid <= 0 {
+		return branch, branch, "", nil
+	}
+	mergeRequest, err := mChecker.GetMergeRequest(projectFullPath, mergeRequestIid)
+	if err != nil {
+		err = fmt.Errorf("resolveMergeRequestRefs() errored in mChecker.GetMergeRequest(): %w", err)
+		return
+	}
+	syntaxRef = cmp.Or(mergeRequest.DiffRefs.HeadSha, mergeRequest.SourceBranch)
+	targetBranch = mergeRequest.TargetBranch
+	author = mergeRequest.Author.Username
+	slog.Debug(fmt.Sprintf("resolveMergeRequestRefs(): merge request !%d checks ref '%v' and targets branch '%v'",
+		mergeRequestIid, syntaxRef, targetBranch))
+	return
+}
+
+// Check codeowners syntax, and record the results in the report. Returns false if there are syntax errors, in
+// which case validation should stop, since there's no sense in trying to analyze a broken file.
+func (v *validator) checkSyntax(checker syntaxChecker, coFilePath string, projectPath string, branch string) (passed bool) {
+	result := CheckResult{Name: "Syntax check", Status: StatusPassed, Findings: []Finding{}}
+	defer func() { v.record(result) }()
+	err := checker.CheckCodeownersSyntax(coFilePath, projectPath, branch)
+	if err == nil {
+		return true
+	}
+	result.Status = StatusFailed
+	// Distinguish actual syntax errors from problems talking to GitLab
+	var validationErrors []error
+	if joinedErr, ok := err.(interface{ Unwrap() []error }); ok {
+		validationErrors = joinedErr.Unwrap()
+	}
+	for _, e := range validationErrors {
+		var validationError *graphql.ValidationError
+		if errors.As(e, &validationError) {
+			finding := Finding{Check: result.Name, Value: validationError.Code, File: coFilePath, Lines: validationError.Lines}
+			finding.Fingerprint = fingerprint(finding)
+			result.Findings = append(result.Findings, finding)
+		}
+	}
+	if len(result.Findings) > 0 {
+		result.Message = "Syntax errors:"
+		result.ExitCode = ExitCodeSyntax
+	} else {
+		if errors.Is(err, graphql.ErrCodeownersNotFound) && localCodeownersExists(v.co) {
+			// The path is right, so the branch on GitLab must not have the file yet
+			err = fmt.Errorf("%w in project '%v' on branch '%v', but it exists locally at '%v'. "+
+				"It may not be committed and pushed to the branch yet", graphql.ErrCodeownersNotFound, projectPath, branch, coFilePath)
+		}
+		result.Error = err.Error()
+		result.ExitCode = ExitCodeInternal
+	}
+	return false
+}
+
+// Return true if the CODEOWNERS file was found locally, either on the file system or in a bare repo
+func localCodeownersExists(co *analysis.CodeownersFileAnatomy) bool {
+	if co.CodeownersFileLines != nil {
+		return true
+	}
+	_, err := os.Stat(filepath.Join(co.RepoRoot, co.CodeownersFilePath))
+	return err == nil
+}
+
+// Read a list file (ex: of file patterns to ignore), one entry per line. Blank lines and #comments are skipped.
+func readListFile(listPath string) (entries []string, err error) {
+	content, err := os.ReadFile(listPath)
+	if err != nil {
+		err = fmt.Errorf("readListFile() unable to read list file '%v': %w", listPath, err)
+		return
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entries = append(entries, line)
+	}
+	return
+}
+
+// Remove the ignored patterns from the file patterns. Also returns each ignored pattern that isn't one of the
+// file patterns, so that the ignore list can be kept clean.
+func removeIgnoredFilePatterns(filePatterns []string, ignoredPatterns []string) (remainingPatterns []string, unusedIgnores []string) {
+	remainingPatterns = filterSlice(filePatterns, ignoredPatterns)
+	unusedIgnores = filterSlice(ignoredPatterns, filePatterns)
+	return
+}
+
+// Verify that each file pattern matches at least one file. Return any patterns that do not have any matches.
+// If repoFiles is nil, then the patterns are matched against the file system under repoRoot. Otherwise,
+// they're matched against the repoFiles list (ex: for a bare repo, which has no working tree).
+// If caseSensitive is true, then any pattern whose file system matches only differ from it by case is returned in
+// caseMismatches, since a case-insensitive file system (ex: macOS, Windows) matches them, but GitLab doesn't. The
+// repoFiles list is matched case-sensitively, so a pattern that only matches its files when case is ignored is
+// returned in caseMismatches too, instead of in badPatterns.
+// If codeownersPath is set (relative to repoRoot), then the CODEOWNERS file itself doesn't count as a match, so
+// that a pattern that only matches it (ex: "docs/" in a sparse checkout with only docs/CODEOWNERS) is returned too,
+// unless the pattern names the file.
+// Stops with an error if ctx is done, which is checked between patterns, since a glob can't be interrupted.
+func checkFilePatterns(ctx context.Context, repoRoot string, filePatterns []string, repoFiles []string, caseSensitive bool,
+	codeownersPath string) (
+	badPatterns []string, caseMismatches []string, err error,
+) {
+	for i, pattern := range filePatterns {
+		if ctx.Err() != nil {
+			err = fmt.Errorf("checkFilePatterns() stopped after %d of %d file patterns: %w", i, len(filePatterns), ctx.Err())
+			return
+		}
+		slog.Debug("checkFilePatterns(): Checking file pattern '" + pattern + "'")
+		if pattern == "*" && codeownersPath == "" { // No need to check this pattern, as it will always have at least one match (the CODEOWNERS file)
+			continue
+		}
+		matches, matchErr := matchFilePattern(repoRoot, pattern, repoFiles)
+		if matchErr != nil {
+			err = fmt.Errorf("checkFilePatterns() error while evaluating glob '%v': %w", pattern, matchErr)
+			return
+		}
+		// A pattern that names the CODEOWNERS file (ex: "/docs/CODEOWNERS", to protect it) is meant to only match it
+		if codeownersPath != "" && len(matches) > 0 && path.Base(pattern) != path.Base(filepath.ToSlash(codeownersPath)) {
+			matches = slices.DeleteFunc(matches, func(match string) bool {
+				return isRepoPath(repoRoot, match, codeownersPath, repoFiles == nil)
+			})
+			if len(matches) == 0 {
+				badPatterns = append(badPatterns, pattern+" (only matches the CODEOWNERS file)")
+				continue
+			}
+		}
+		if len(matches) == 0 && caseSensitive && repoFiles != nil {
+			// The repoFiles list is matched case-sensitively, so look for files that only differ by case
+			foldedMatches, foldErr := matchRepoFilesFold(repoRoot, TranslateCoToGlob(repoRoot, pattern), repoFiles)
+			if foldErr == nil && len(foldedMatches) > 0 {
+				caseMismatches = append(caseMismatches, fmt.Sprintf("%v (in the repo: %v)", pattern, foldedMatches[0]))
+				continue
+			}
+		}
+		if len(matches) == 0 {
+			badPatterns = append(badPatterns, pattern)
+		} else if caseSensitive && repoFiles == nil {
+			// The repoFiles list is already matched case-sensitively, but the file system might not be
+			if mismatch, found := findCaseMismatch(repoRoot, matches); found {
+				caseMismatches = append(caseMismatches, fmt.Sprintf("%v (on disk: %v)", pattern, mismatch))
+			}
+		}
+	}
+	return
+}
+
+// Check whether a match is the file at repoPath (relative to repoRoot). Matches from the file system include
+// repoRoot, while matches from a list of repo files are already relative to it.
+func isRepoPath(repoRoot string, match string, repoPath string, fromFileSystem bool) bool {
+	if fromFileSystem {
+		relativePath, err := filepath.Rel(repoRoot, match)
+		if err != nil {
+			return false
+		}
+		match = relativePath
+	}
+	return filepath.ToSlash(filepath.Clean(match)) == filepath.ToSlash(filepath.Clean(repoPath))
+}
+
+// Return the paths that a file pattern matches. If repoFiles is nil, then the pattern is matched against the file
+// system under repoRoot, which includes directories. Otherwise, it's matched against the repoFiles list.
+func matchFilePattern(repoRoot string, pattern string, repoFiles []string) (matches []string, err error) {
+	globExpression := TranslateCoToGlob(repoRoot, pattern)
+	slog.Debug("matchFilePattern(): translated '" + pattern + "' to glob expression '" + globExpression + "'")
+	if repoFiles == nil {
+		matches, err = doublestar.Glob(globExpression)
+	} else {
+		matches, err = matchRepoFiles(repoRoot, globExpression, repoFiles)
+	}
+	slog.Debug(fmt.Sprintf("matchFilePattern(): found %d matches for glob expression '%v'", len(matches), globExpression))
+	return
+}
+
+// Count the files that each file pattern matches (not counting directories), and return the patterns sorted by
+// their counts, most first. Patterns with the same count stay in their original order.
+func countFilePatternMatches(repoRoot string, filePatterns []string, repoFiles []string) (counts []patternMatchCount, err error) {
+	for _, pattern := range filePatterns {
+		matches, matchErr := matchFilePattern(repoRoot, pattern, repoFiles)
+		if matchErr != nil {
+			return nil, fmt.Errorf("countFilePatternMatches() error while evaluating glob '%v': %w", pattern, matchErr)
+		}
+		count := len(matches)
+		if repoFiles == nil {
+			count = 0
+			for _, match := range matches {
+				if info, statErr := os.Stat(match); statErr == nil && !info.IsDir() {
+					count++
+				}
+			}
+		}
+		counts = append(counts, patternMatchCount{pattern: pattern, files: count})
+	}
+	slices.SortStableFunc(counts, func(a, b patternMatchCount) int { return cmp.Compare(b.files, a.files) })
+	return
+}
+
+// The number of files that a file pattern matches
+type patternMatchCount struct {
+	pattern string
+	files   int
+}
+
+// Check whether every match only exists on disk with a different case than it was matched with. If so, return
+// the first match with its on-disk case (ex: "docs/README.md" when matched as "Docs/README.md").
+func findCaseMismatch(repoRoot string, matches []string) (mismatch string, found bool) {
+	root := filepath.ToSlash(filepath.Clean(repoRoot))
+	for _, match := range matches {
+		relativePath := strings.TrimPrefix(filepath.ToSlash(match), root+"/")
+		onDisk := onDiskCase(root, relativePath)
+		if onDisk == relativePath {
+			return "", false
+		}
+		if mismatch == "" {
+			mismatch = onDisk
+		}
+	}
+	return mismatch, true
+}
+
+// Return the relativePath (ex: "Docs/README.md") with each part's case as it's listed in its directory under
+// repoRoot (ex: "docs/README.md"). Parts that can't be listed are returned as they are.
+func onDiskCase(repoRoot string, relativePath string) string {
+	parent := path.Dir(relativePath)
+	name := path.Base(relativePath)
+	if parent != "." {
+		parent = onDiskCase(repoRoot, parent)
+	}
+	entries, err := os.ReadDir(filepath.Join(repoRoot, parent))
+	if err == nil && !slices.ContainsFunc(entries, func(e os.DirEntry) bool { return e.Name() == name }) {
+		for _, entry := range entries {
+			if strings.EqualFold(entry.Name(), name) {
+				name = entry.Name()
+				break
+			}
+		}
+	}
+	return path.Join(parent, name)
+}
+
+// Return each file pattern with a ".." path component, ex: "/../secrets". These can't refer to anything in the
+// repo, and usually indicate a copy-paste error.
+func checkPathTraversal(filePatterns []string) (traversalPatterns []string) {
+	for _, pattern := range filePatterns {
+		if slices.Contains(strings.Split(pattern, "/"), "..") {
+			traversalPatterns = append(traversalPatterns, pattern)
+		}
+	}
+	return
+}
+
+// Return each file pattern that names a directory without a trailing slash, ex: "/src/app". GitLab only matches
+// such a pattern against a file with that name, so "/src/app/" was probably intended. Only patterns whose last
+// part is a literal name are checked, since a wildcard like "/src/*" is expected to match directories too. If
+// repoFiles is nil, then the file system under repoRoot is checked, otherwise the directories in repoFiles.
+func checkDirectoryPatterns(repoRoot string, filePatterns []string, repoFiles []string) (dirPatterns []string, err error) {
+	var repoDirs []string
+	seenDirs := map[string]bool{}
+	for _, file := range repoFiles {
+		for dir := path.Dir(file); dir != "." && !seenDirs[dir]; dir = path.Dir(dir) {
+			seenDirs[dir] = true
+			repoDirs = append(repoDirs, dir)
+		}
+	}
+	for _, pattern := range filePatterns {
+		if strings.HasSuffix(pattern, "/") || strings.ContainsAny(path.Base(pattern), "*?[") {
+			continue
+		}
+		globExpression := TranslateCoToGlob(repoRoot, pattern)
+		var matches []string
+		var matchErr error
+		if repoFiles == nil {
+			matches, matchErr = doublestar.Glob(globExpression)
+		} else {
+			matches, matchErr = matchRepoFiles(repoRoot, globExpression, repoDirs)
+		}
+		if matchErr != nil {
+			err = fmt.Errorf("checkDirectoryPatterns() error while evaluating glob '%v': %w", pattern, matchErr)
+			return
+		}
+		isDirectory := repoFiles != nil && len(matches) > 0
+		for _, match := range matches {
+			if info, statErr := os.Stat(match); repoFiles == nil && statErr == nil && info.IsDir() {
+				isDirectory = true
+				break
+			}
+		}
+		if isDirectory {
+			dirPatterns = append(dirPatterns, pattern)
+		}
+	}
+	return
+}
+
+// Return the files from the repoFiles list that match the glob expression. The repoFiles paths are relative
+// to repoRoot (ex: "docs/README.md"), just like git lists them.
+func matchRepoFiles(repoRoot string, globExpression string, repoFiles []string) (matches []string, err error) {
+	root := filepath.ToSlash(filepath.Clean(repoRoot))
+	for _, file := range repoFiles {
+		matched, matchErr := doublestar.Match(globExpression, root+"/"+file)
+		if matchErr != nil {
+			return nil, matchErr
+		}
+		if matched {
+			matches = append(matches, file)
+		}
+	}
+	return
+}
+
+// Return the files from the repoFiles list that match the glob expression when case is ignored, ex: "/Docs/*"
+// matches "docs/README.md"
+func matchRepoFilesFold(repoRoot string, globExpression string, repoFiles []string) (matches []string, err error) {
+	root := filepath.ToSlash(filepath.Clean(repoRoot))
+	for _, file := range repoFiles {
+		matched, matchErr := doublestar.Match(strings.ToLower(globExpression), strings.ToLower(root+"/"+file))
+		if matchErr != nil {
+			return nil, matchErr
+		}
+		if matched {
+			matches = append(matches, file)
+		}
+	}
+	return
+}
+
+// Translate a CODEOWNERS file pattern into a standard glob expression, relative to the repo's root directory.
+// GitLab matches file patterns with Ruby's File.fnmatch(), which doesn't expand {a,b} braces like doublestar
+// does, so braces are escaped to be matched literally.
+func TranslateCoToGlob(repoRoot string, pattern string) (translatedPattern string) {
+	translatedPattern = escapeBraces(pattern)
+	// Escape any glob characters in the root directory's name, so that they're matched literally
+	root := globEscaper.Replace(filepath.ToSlash(filepath.Clean(repoRoot)))
+	switch {
+	case strings.HasPrefix(pattern, "/"):
+		// https://docs.gitlab.com/ee/user/project/codeowners/reference.html#absolute-paths
+		translatedPattern = root + translatedPattern
+	case strings.HasPrefix(pattern, "**/"):
+		// Already matches at any depth, ex: "**/logs/"
+		translatedPattern = root + "/" + translatedPattern
+	default:
+		// https://docs.gitlab.com/ee/user/project/codeowners/reference.html#relative-paths
+		translatedPattern = root + "/**/" + translatedPattern
+	}
+	if strings.HasSuffix(pattern, "/") {
+		// https://docs.gitlab.com/ee/user/project/codeowners/reference.html#directory-paths
+		translatedPattern = translatedPattern + "**/*"
+	}
+	return
+}
+
+// Escape each "{" and "}" in the pattern that isn't already escaped
+func escapeBraces(pattern string) string {
+	var escaped strings.Builder
+	for i, c := range pattern {
+		if (c == '{' || c == '}') && !analysis.IsEscaped(pattern, i) {
+			escaped.WriteByte('\\')
+		}
+		escaped.WriteRune(c)
+	}
+	return escaped.String()
+}
+
+// Check that owner entries (users, groups, emails) are direct members of the project. Since user and group owners are both
+// specified by "@name" and are therefore indistinguishable until checked, these are provided in a combined list.
+// Returns any remaining users/groups and emails that were not found as direct members of the project.
+// The three member sources are fetched concurrently, since they are independent reads. They are still checked off
+// in a fixed order (groups, then users in invited groups, then direct users), so the results are deterministic,
+// and the check returns as soon as everything has been checked off, without waiting on the remaining fetches.
+// If groupPrefix is set (ex: "acme"), then a group owner also matches when it's missing the prefix, ex:
+// @platform-team matches the acme/platform-team group.
+func (v *validator) checkOwners(uChecker userChecker, gChecker groupChecker, projectFullPath string, ugList []string, emailList []string,
+	groupPrefix string) (
+	remainingUsersGroups []string,
+	remainingEmails []string,
+	err error,
+) {
+	// Make editable copies of the lists, so that we can remove items as we verify them (i.e. check them off the list)
+	remainingUsersGroups = make([]string, len(ugList))
+	copy(remainingUsersGroups, ugList)
+	remainingEmails = make([]string, len(emailList))
+	copy(remainingEmails, emailList)
+
+	// Start all the fetches. The channels are buffered so that a fetch never blocks if its results aren't needed.
+	groupResults := make(chan memberFetchResult, 1)
+	invitedResults := make(chan memberFetchResult, 1)
+	directResults := make(chan memberFetchResult, 1)
+	go func() {
+		defer v.recordTiming("Group members", time.Now())
+		groupsFound, err := gChecker.GetDirectGroupMembers(projectFullPath)
+		groupResults <- memberFetchResult{usernames: groupsFound, err: err}
+	}()
+	go func() {
+		defer v.recordTiming("User members (invited groups)", time.Now())
+		usernamesFound, emailsFound, err := uChecker.GetDirectUserMembers(projectFullPath, "INVITED_GROUPS")
+		invitedResults <- memberFetchResult{usernames: usernamesFound, emails: emailsFound, err: err}
+	}()
+	go func() {
+		defer v.recordTiming("User members (direct)", time.Now())
+		usernamesFound, emailsFound, err := uChecker.GetDirectUserMembers(projectFullPath, "DIRECT")
+		directResults <- memberFetchResult{usernames: usernamesFound, emails: emailsFound, err: err}
+	}()
+
+	slog.Debug("checkOwners() is checking off groups that are direct members of the project...")
+	groups := <-groupResults
+	if groups.err != nil {
+		err = fmt.Errorf("checkOffUsersAndGroups() errored in gChecker.GetDirectGroupMembers(): %w", groups.err)
+		return
+	}
+	remainingUsersGroups = filterGroups(remainingUsersGroups, addUnprefixedGroups(groups.usernames, groupPrefix))
+	if len(remainingUsersGroups) == 0 && len(remainingEmails) == 0 { // All checked off?
+		return
+	}
+
+	slog.Debug("checkOwners() is checking off users+emails in groups that are direct members of the project...")
+	invited := <-invitedResults
+	if invited.err != nil {
+		err = fmt.Errorf("checkOffUsersAndGroups() errored in uChecker.GetDirectUserMembers() INVITED_GROUPS: %w", invited.err)
+		return
+	}
+	remainingUsersGroups = filterSlice(remainingUsersGroups, invited.usernames)
+	remainingEmails = filterEmails(remainingEmails, invited.emails)
+	if len(remainingUsersGroups) == 0 && len(remainingEmails) == 0 { // All checked off?
+		return
+	}
+
+	slog.Debug("checkOwners() is checking off users+emails that are themselves direct members of the project...")
+	direct := <-directResults
+	if direct.err != nil {
+		err = fmt.Errorf("checkOffUsersAndGroups() errored in uChecker.GetDirectUserMembers() DIRECT: %w", direct.err)
+		return
+	}
+	remainingUsersGroups = filterSlice(remainingUsersGroups, direct.usernames)
+	remainingEmails = filterEmails(remainingEmails, direct.emails)
+	return
+}
+
+// Return the leftover owners, minus each group that has a subgroup (at any depth) that's a direct member of the
+// project. Each group's tree of subgroups is only looked up once per run, and a subgroup's tree is taken from its
+// parent's tree if the parent is also a leftover.
+func resolveSubgroupOwners(sResolver subgroupResolver, gChecker groupChecker, projectFullPath string, leftovers []string) (
+	remaining []string, err error,
+) {
+	if len(leftovers) == 0 {
+		return
+	}
+	directGroups, err := gChecker.GetDirectGroupMembers(projectFullPath)
+	if err != nil {
+		err = fmt.Errorf("resolveSubgroupOwners() errored in gChecker.GetDirectGroupMembers(): %w", err)
+		return
+	}
+	// Sorting puts each parent group before its subgroups, so that their trees come from the parent's
+	sortedLeftovers := slices.Clone(leftovers)
+	slices.Sort(sortedLeftovers)
+	groupTrees := map[string][]string{} // Group full path -> full paths of its descendant groups
+	resolved := map[string]bool{}
+	for _, owner := range sortedLeftovers {
+		var descendants []string
+		cachedParent := slices.IndexFunc(sortedLeftovers, func(parent string) bool {
+			_, cached := groupTrees[parent]
+			return cached && strings.HasPrefix(owner, parent+"/")
+		})
+		if cachedParent >= 0 {
+			for _, group := range groupTrees[sortedLeftovers[cachedParent]] {
+				if strings.HasPrefix(group, owner+"/") {
+					descendants = append(descendants, group)
+				}
+			}
+		} else {
+			descendants, err = sResolver.GetDescendantGroups(owner)
+			if err != nil {
+				err = fmt.Errorf("resolveSubgroupOwners() errored in sResolver.GetDescendantGroups(): %w", err)
+				return
+			}
+		}
+		groupTrees[owner] = descendants
+		for _, group := range descendants {
+			if slices.Contains(directGroups, group) {
+				slog.Debug(fmt.Sprintf("resolveSubgroupOwners(): '%v' is resolved by its subgroup '%v'", owner, group))
+				resolved[owner] = true
+				break
+			}
+		}
+	}
+	for _, owner := range leftovers {
+		if !resolved[owner] {
+			remaining = append(remaining, owner)
+		}
+	}
+	return
+}
+
+// Return the groups, plus the path of each group that starts with the prefix (in any casing), without the prefix.
+// Returns the groups as they are if the prefix is empty.
+func addUnprefixedGroups(groups []string, groupPrefix string) []string {
+	groupPrefix = strings.Trim(groupPrefix, "/")
+	if groupPrefix == "" {
+		return groups
+	}
+	allGroups := slices.Clone(groups)
+	for _, group := range groups {
+		if len(group) > len(groupPrefix)+1 && strings.EqualFold(group[:len(groupPrefix)+1], groupPrefix+"/") {
+			allGroups = append(allGroups, group[len(groupPrefix)+1:])
+		}
+	}
+	return allGroups
+}
+
+// Return the emails in original that aren't in filterAgainst, comparing them with normalizeEmail(), so that
+// ex: Alice@Example.com is checked off by alice@example.com. The emails are returned with their original casing.
+func filterEmails(original []string, filterAgainst []string) (filteredList []string) {
+	normalizedAgainst := make([]string, 0, len(filterAgainst))
+	for _, email := range filterAgainst {
+		normalizedAgainst = append(normalizedAgainst, normalizeEmail(email))
+	}
+	filteredList = make([]string, 0, len(original))
+	for _, email := range original {
+		if !slices.Contains(normalizedAgainst, normalizeEmail(email)) {
+			filteredList = append(filteredList, email)
+		}
+	}
+	return
+}
+
+// Return the email in the form that's used to compare it. Email domains are case-insensitive. The local part
+// (before the "@") is case-sensitive by the RFC, but GitLab looks up emails case-insensitively, so it's
+// lowercased too. Nothing else is normalized, ex: dots or "+tag" suffixes, since those can be different addresses.
+func normalizeEmail(email string) string {
+	return strings.ToLower(email)
+}
+
+// Return the owners in original that aren't in the groups that were found, comparing them with
+// normalizeGroupPath(), so that ex: @acme/platform is checked off by the acme/Platform group. The owners are
+// returned with their original casing. Usernames are still compared exactly by filterSlice(), since this is only
+// for the group members of the project.
+func filterGroups(original []string, groupsFound []string) (filteredList []string) {
+	slog.Debug("filterGroups() is filtering original slice: " + strings.Join(original, " "))
+	normalizedFound := make([]string, 0, len(groupsFound))
+	for _, group := range groupsFound {
+		normalizedFound = append(normalizedFound, normalizeGroupPath(group))
+	}
+	filteredList = make([]string, 0, len(original))
+	for _, owner := range original {
+		if !slices.Contains(normalizedFound, normalizeGroupPath(owner)) {
+			filteredList = append(filteredList, owner)
+		}
+	}
+	return
+}
+
+// Return the group full path in the form that's used to compare it. GitLab group paths are case-insensitive, and
+// a leading or trailing "/" doesn't change which group it is, ex: "/Acme/Platform/" is the same as "acme/platform".
+func normalizeGroupPath(fullPath string) string {
+	return strings.ToLower(strings.Trim(fullPath, "/"))
+}
+
+// The members returned by one of checkOwners()' concurrent fetches
+type memberFetchResult struct {
+	usernames []string // Usernames, or group full paths
+	emails    []string
+	err       error
+}
+
+// Return each denied owner that appears in the CODEOWNERS file, along with the line numbers that reference it.
+// Denied owners may be specified with or without the "@" prefix. They're compared case-insensitively, like GitLab
+// compares usernames and group paths, and reported as they're written in the CODEOWNERS file.
+func checkDeniedOwners(ownerLines map[string][]int, deniedOwners []string) (foundOwners []string) {
+	owners := make([]string, 0, len(ownerLines))
+	for owner := range ownerLines {
+		owners = append(owners, owner)
+	}
+	slices.Sort(owners)
+	for _, denied := range deniedOwners {
+		denied = strings.TrimPrefix(strings.TrimSpace(denied), "@")
+		for _, owner := range owners {
+			if strings.EqualFold(owner, denied) {
+				foundOwners = append(foundOwners, owner+" on lines: "+FormatLineNumbers(ownerLines[owner]))
+			}
+		}
+	}
+	return
+}
+
+// Return each email owner whose domain (the part after the "@") isn't one of the allowedDomains, along with the
+// line numbers that reference it. Domains are compared case-insensitively, and a subdomain doesn't match its
+// parent domain (ex: "alice@eng.example.com" isn't allowed by "example.com").
+func checkEmailDomains(emailPatterns []string, ownerLines map[string][]int, allowedDomains []string) (disallowedEmails []string) {
+	for _, email := range emailPatterns {
+		domain := email[strings.LastIndex(email, "@")+1:]
+		isAllowed := slices.ContainsFunc(allowedDomains, func(allowed string) bool {
+			return strings.EqualFold(domain, strings.TrimPrefix(strings.TrimSpace(allowed), "@"))
+		})
+		if !isAllowed {
+			disallowedEmails = append(disallowedEmails, email+" on lines: "+FormatLineNumbers(ownerLines[email]))
+		}
+	}
+	return
+}
+
+// Return each user or group owner that's also written with different casing elsewhere in the file, ex: @Alice and
+// @alice. GitLab looks them up case-insensitively, but they're confusing to read, and show up as separate entries.
+// The form that's used on the most lines is suggested, with ties going to the form that appears first.
+func checkOwnerCasing(userAndGroupPatterns []string, ownerLines map[string][]int) (inconsistentOwners []string) {
+	variants := map[string][]string{} // Lowercased owner -> the owner's forms, ex: "alice" -> ["Alice", "alice"]
+	var lowercased []string
+	for _, owner := range userAndGroupPatterns {
+		key := strings.ToLower(owner)
+		if _, found := variants[key]; !found {
+			lowercased = append(lowercased, key)
+		}
+		variants[key] = append(variants[key], owner)
+	}
+	for _, key := range lowercased {
+		forms := variants[key]
+		if len(forms) < 2 {
+			continue
+		}
+		canonical := slices.MaxFunc(forms, func(a, b string) int {
+			if c := cmp.Compare(len(ownerLines[a]), len(ownerLines[b])); c != 0 {
+				return c
+			}
+			return cmp.Compare(ownerLines[b][0], ownerLines[a][0])
+		})
+		for _, form := range forms {
+			if form != canonical {
+				inconsistentOwners = append(inconsistentOwners, fmt.Sprintf("%v on lines: %v (use %v, as on lines: %v)",
+					form, FormatLineNumbers(ownerLines[form]), canonical, FormatLineNumbers(ownerLines[canonical])))
+			}
+		}
+	}
+	return
+}
+
+// Return each entry owner that's also one of its section's default owners, ex: "@backend-team on line 5 (a
+// default owner of [Backend])". Owners are compared case-insensitively, like GitLab looks them up. Note that an
+// entry with its own owners replaces the section's default owners, rather than adding to them, so the owner can
+// only be dropped if the entry doesn't need its other owners either.
+func checkRedundantOwners(sections []analysis.Section) (redundantOwners []string) {
+	for _, section := range sections {
+		for _, entry := range section.Entries {
+			for _, owner := range entry.Owners {
+				isDefault := slices.ContainsFunc(section.DefaultOwners, func(d string) bool { return strings.EqualFold(d, owner) })
+				if isDefault {
+					redundantOwners = append(redundantOwners, fmt.Sprintf("%v on line %d (a default owner of %v)",
+						owner, entry.Line, section.Heading))
+				}
+			}
+		}
+	}
+	return
+}
+
+// Return each owner that doesn't apply to any file pattern, along with the line numbers that reference it, ex: the
+// default owners of a section with no entries, or of a section whose entries all list their own owners. They
+// look like they own something, but they're never asked to approve anything.
+func checkUnusedOwners(ownerFilePatterns map[string][]string, ownerLines map[string][]int) (unusedOwners []string) {
+	var owners []string
+	for owner, filePatterns := range ownerFilePatterns {
+		if len(filePatterns) == 0 {
+			owners = append(owners, owner)
+		}
+	}
+	slices.Sort(owners)
+	return appendLineNumbers(ownerLines, owners)
+}
+
+// Return each user owner that matches the bot username pattern (ex: project_123_bot, the user of a project access
+// token), along with the line numbers that reference it. Bot accounts can't review merge requests, so they can't
+// meaningfully approve as code owners.
+func checkBotOwners(userAndGroupPatterns []string, ownerLines map[string][]int, botPattern *regexp.Regexp) (botOwners []string) {
+	for _, owner := range userAndGroupPatterns {
+		if botPattern.MatchString(owner) {
+			botOwners = append(botOwners, owner+" on lines: "+FormatLineNumbers(ownerLines[owner]))
+		}
+	}
+	return
+}
+
+// Return a description of each section that requires more approvals than it has distinct owners (default
+// owners plus the owners of its entries), since merges that need its approval can never be satisfied. Note that
+// a group is counted as one owner. Optional (^) sections are returned separately, since they don't block merges.
+func checkSectionApprovals(sections []analysis.Section) (unsatisfiableSections []string, unsatisfiableOptionalSections []string) {
+	for _, section := range sections {
+		if section.ApprovalCount == 0 {
+			continue
+		}
+		owners := map[string]bool{}
+		for _, owner := range section.DefaultOwners {
+			owners[ownerKey(owner)] = true
+		}
+		for _, entry := range section.Entries {
+			for _, owner := range entry.Owners {
+				owners[ownerKey(owner)] = true
+			}
+		}
+		if section.ApprovalCount > len(owners) {
+			description := fmt.Sprintf("%v on line %d requires %d approvals, but has %d owners",
+				section.Heading, section.Line, section.ApprovalCount, len(owners))
+			if section.Optional {
+				unsatisfiableOptionalSections = append(unsatisfiableOptionalSections, description)
+			} else {
+				unsatisfiableSections = append(unsatisfiableSections, description)
+			}
+		}
+	}
+	return
+}
+
+// Return the owner in the form that's used to tell whether two owners are the same, i.e. emails are normalized,
+// and users and groups are lowercased, since GitLab matches their paths case-insensitively
+func ownerKey(owner string) string {
+	if strings.HasPrefix(owner, "@") {
+		return strings.ToLower(owner)
+	}
+	return normalizeEmail(owner)
+}
+
+// Return a description of each section that requires more approvals than the number of distinct approvers
+// among its owners, where each group owner is expanded into its members. Each owner is only looked up once per
+// run, since the same groups are usually listed in many sections.
+func checkApproverCapacity(cChecker approverCapacityChecker, sections []analysis.Section) (lowCapacitySections []string, err error) {
+	approversCache := map[string][]string{} // Owner -> approvers, ex: "@my-group" -> ["alice", "bob"]
+	for _, section := range sections {
+		if section.ApprovalCount == 0 {
+			continue
+		}
+		owners := slices.Clone(section.DefaultOwners)
+		for _, entry := range section.Entries {
+			owners = append(owners, entry.Owners...)
+		}
+		approvers := map[string]bool{}
+		for _, owner := range owners {
+			ownerApprovers, cached := approversCache[owner]
+			if !cached {
+				ownerApprovers, err = getOwnerApprovers(cChecker, owner)
+				if err != nil {
+					err = fmt.Errorf("checkApproverCapacity() errored on section '%v': %w", section.Heading, err)
+					return
+				}
+				approversCache[owner] = ownerApprovers
+			}
+			for _, approver := range ownerApprovers {
+				approvers[approver] = true
+			}
+		}
+		if section.ApprovalCount > len(approvers) {
+			lowCapacitySections = append(lowCapacitySections, fmt.Sprintf("%v on line %d requires %d approvals, but has %d approvers",
+				section.Heading, section.Line, section.ApprovalCount, len(approvers)))
+		}
+	}
+	return
+}
+
+// Return a description of each owner that is only a member of the project through groups that the project is shared
+// with at less than Developer access, which can't approve merge requests. That includes a group owner that is
+// itself shared with the project at too low an access level. Owners who are direct members of the project, or
+// members of any group that's shared with enough access, are assumed to be able to approve.
+func checkInvitedGroupAccess(iChecker invitedAccessChecker, projectFullPath string, ugList []string, emailList []string) (lowAccessOwners []string, err error) {
+	sharedGroups, err := iChecker.GetSharedGroups(projectFullPath)
+	if err != nil {
+		err = fmt.Errorf("checkInvitedGroupAccess() errored in iChecker.GetSharedGroups(): %w", err)
+		return
+	}
+	usernames, emails, err := iChecker.GetDirectUserMembers(projectFullPath, "DIRECT")
+	if err != nil {
+		err = fmt.Errorf("checkInvitedGroupAccess() errored in iChecker.GetDirectUserMembers(): %w", err)
+		return
+	}
+	canApprove := map[string]bool{} // Usernames and normalized emails
+	for _, username := range usernames {
+		canApprove[username] = true
+	}
+	for _, email := range emails {
+		canApprove[normalizeEmail(email)] = true
+	}
+	lowAccessGroups := map[string]rest.Group{} // Username or normalized email -> first low access group it's in
+	for _, group := range sharedGroups {
+		isOwner := slices.ContainsFunc(ugList, func(owner string) bool { return strings.EqualFold(owner, group.GroupFullPath) })
+		if group.GroupAccessLevel < rest.DeveloperAccess && isOwner {
+			lowAccessOwners = append(lowAccessOwners, fmt.Sprintf("%v (the group is shared with %v access)",
+				group.GroupFullPath, rest.AccessLevelName(group.GroupAccessLevel)))
+		}
+		members, membersErr := iChecker.GetGroupMembers(group.GroupId)
+		if membersErr != nil {
+			err = fmt.Errorf("checkInvitedGroupAccess() errored in iChecker.GetGroupMembers(): %w", membersErr)
+			return
+		}
+		for _, member := range members {
+			for _, key := range []string{member.Username, normalizeEmail(member.Email), normalizeEmail(member.PublicEmail)} {
+				if key == "" {
+					continue
+				}
+				if group.GroupAccessLevel >= rest.DeveloperAccess {
+					canApprove[key] = true
+				} else if _, found := lowAccessGroups[key]; !found {
+					lowAccessGroups[key] = group
+				}
+			}
+		}
+	}
+	for _, owner := range slices.Concat(ugList, emailList) {
+		key := owner
+		if slices.Contains(emailList, owner) {
+			key = normalizeEmail(owner)
+		}
+		group, found := lowAccessGroups[key]
+		if found && !canApprove[key] {
+			lowAccessOwners = append(lowAccessOwners, fmt.Sprintf("%v (only through group %v, which is shared with %v access)",
+				owner, group.GroupFullPath, rest.AccessLevelName(group.GroupAccessLevel)))
+		}
+	}
+	return
+}
+
+// Return each user or group owner that is a group with private visibility, along with its line numbers. Every
+// owner is looked up, since a user and a group owner look the same in the CODEOWNERS file.
+func checkGroupVisibility(vChecker groupVisibilityChecker, ugList []string, ownerLines map[string][]int) (privateGroups []string, err error) {
+	var privateGroupPaths []string
+	for _, owner := range ugList {
+		group, lookupErr := vChecker.GetGroupByFullPath(owner)
+		if lookupErr != nil {
+			err = fmt.Errorf("checkGroupVisibility() errored in vChecker.GetGroupByFullPath(): %w", lookupErr)
+			return
+		}
+		if group != nil && group.Visibility == "private" {
+			privateGroupPaths = append(privateGroupPaths, owner)
+		}
+	}
+	privateGroups = appendLineNumbers(ownerLines, privateGroupPaths)
+	return
+}
+
+// Return each entry for one of the file patterns (ex: the ones that match changed files) whose only owner is the
+// author, ex: "docs/ on line 12". An entry without its own owners is owned by its section's default owners.
+func checkAuthorOwnedEntries(sections []analysis.Section, filePatterns []string, author string) (authorOwnedEntries []string) {
+	for _, section := range sections {
+		for _, entry := range section.Entries {
+			owners := entry.Owners
+			if len(owners) == 0 {
+				owners = section.DefaultOwners
+			}
+			if len(owners) == 1 && strings.EqualFold(owners[0], "@"+author) && slices.Contains(filePatterns, entry.FilePattern) {
+				authorOwnedEntries = append(authorOwnedEntries, fmt.Sprintf("%v on line %d", entry.FilePattern, entry.Line))
+			}
+		}
+	}
+	return
+}
+
+// Return each user or group owner that isn't part of the required parent group, along with its line numbers. A
+// user is part of it if they're a member (including inherited membership), and a group is part of it if it's the
+// group itself or one of its subgroups.
+func checkRequiredParentGroup(pChecker approverCapacityChecker, parentGroup string, ugList []string, ownerLines map[string][]int) (outsideOwners []string, err error) {
+	parentGroup = strings.Trim(parentGroup, "/")
+	group, err := pChecker.GetGroupByPath(parentGroup)
+	if err != nil {
+		err = fmt.Errorf("checkRequiredParentGroup() errored in pChecker.GetGroupByPath(): %w", err)
+		return
+	}
+	if group == nil {
+		err = fmt.Errorf("checkRequiredParentGroup() group '%v' does not exist, or is not visible to the token", parentGroup)
+		return
+	}
+	members, err := pChecker.GetGroupMembers(group.Id)
+	if err != nil {
+		err = fmt.Errorf("checkRequiredParentGroup() errored in pChecker.GetGroupMembers(): %w", err)
+		return
+	}
+	var outsidePaths []string
+	for _, owner := range ugList {
+		isMember := slices.ContainsFunc(members, func(member rest.Member) bool {
+			return strings.EqualFold(member.Username, owner)
+		})
+		isSubgroup := strings.EqualFold(owner, parentGroup) || strings.HasPrefix(strings.ToLower(owner), strings.ToLower(parentGroup)+"/")
+		if !isMember && !isSubgroup {
+			outsidePaths = append(outsidePaths, owner)
+		}
+	}
+	outsideOwners = appendLineNumbers(ownerLines, outsidePaths)
+	return
+}
+
+// Return the users that can approve on behalf of an owner: the members of a group, or else the user (or email)
+// itself.
+func getOwnerApprovers(cChecker approverCapacityChecker, owner string) (approvers []string, err error) {
+	if !strings.HasPrefix(owner, "@") {
+		return []string{owner}, nil
+	}
+	name := strings.TrimPrefix(owner, "@")
+	group, err := cChecker.GetGroupByPath(name)
+	if err != nil {
+		err = fmt.Errorf("getOwnerApprovers() errored in cChecker.GetGroupByPath(): %w", err)
+		return
+	}
+	if group == nil {
+		return []string{name}, nil
+	}
+	members, err := cChecker.GetGroupMembers(group.Id)
+	if err != nil {
+		err = fmt.Errorf("getOwnerApprovers() errored in cChecker.GetGroupMembers(): %w", err)
+		return
+	}
+	for _, member := range members {
+		approvers = append(approvers, member.Username)
+	}
+	return
+}
+
+// Return each name (ex: an owner) along with the line numbers that reference it, ex: "team-* on lines: 3, 7"
+func appendLineNumbers(nameLines map[string][]int, names []string) (namesWithLines []string) {
+	for _, name := range names {
+		namesWithLines = append(namesWithLines, name+" on lines: "+FormatLineNumbers(nameLines[name]))
+	}
+	return
+}
+
+// Format a list of line numbers for display, ex: "3, 7, 12"
+func FormatLineNumbers(lines []int) string {
+	lineStrings := make([]string, len(lines))
+	for i, line := range lines {
+		lineStrings[i] = strconv.Itoa(line)
+	}
+	return strings.Join(lineStrings, ", ")
+}
+
+// Check that the branch is protected with "Require approval from code owners" enabled, since a CODEOWNERS file
+// doesn't enforce anything without it. The branch can be protected by its name or by a wildcard (ex: "release/*"),
+// and like GitLab, approval is required if any of the protected branches that match it require it. Returns a
+// description of the problem, if there is one.
+func checkApprovalSetting(aChecker approvalSettingChecker, projectFullPath string, branch string) (problems []string, err error) {
+	protectedBranches, err := aChecker.GetProtectedBranches(projectFullPath)
+	if err != nil {
+		err = fmt.Errorf("checkApprovalSetting() errored in aChecker.GetProtectedBranches(): %w", err)
+		return
+	}
+	matching := rest.MatchingProtectedBranches(protectedBranches, branch)
+	if len(matching) == 0 {
+		problems = append(problems, "branch '"+branch+"' is not protected, so code owner approval cannot be required")
+		return
+	}
+	var names []string
+	for _, protectedBranch := range matching {
+		if protectedBranch.CodeOwnerApprovalRequired {
+			return
+		}
+		names = append(names, "'"+protectedBranch.Name+"'")
+	}
+	problems = append(problems, fmt.Sprintf("branch '%v' is protected by %v, but 'Require approval from code owners' is not enabled",
+		branch, strings.Join(names, ", ")))
+	return
+}
+
+// A problem with an owner, as found by one of the checks that classify the owners that weren't found as members.
+// The owner is as it's listed in the CODEOWNERS file (ex: "my-group/team"), so that its lines can be found.
+type ownerProblem struct {
+	owner  string
+	detail string // Explains the problem (ex: the path that a renamed group moved to), or "" if the check says it all
+}
+
+// Return true if any of the problems are with the owner
+func hasOwnerProblem(problems []ownerProblem, owner string) bool {
+	return slices.ContainsFunc(problems, func(p ownerProblem) bool { return p.owner == owner })
+}
+
+// Check whether any of the users/groups that weren't found as direct members are actually groups that were
+// renamed or moved after being shared with the project. GitLab redirects old group paths, so looking up the
+// old path returns the group under its new path, and the share still exists if that group's ID is one of the
+// project's shared groups. Returns each renamed group, with the path to use instead.
+func checkRenamedGroups(rChecker groupRenameChecker, projectFullPath string, ugLeftovers []string) (renamedGroups []ownerProblem, err error) {
+	if len(ugLeftovers) == 0 {
+		return
+	}
+	sharedGroups, err := rChecker.GetSharedGroups(projectFullPath)
+	if err != nil {
+		err = fmt.Errorf("checkRenamedGroups() errored in rChecker.GetSharedGroups(): %w", err)
+		return
+	}
+	for _, ug := range ugLeftovers {
+		slog.Debug("checkRenamedGroups(): looking up '" + ug + "' as a group")
+		group, lookupErr := rChecker.GetGroupByPath(ug)
+		if lookupErr != nil {
+			err = fmt.Errorf("checkRenamedGroups() errored in rChecker.GetGroupByPath(): %w", lookupErr)
+			return
+		}
+		if group == nil || strings.EqualFold(group.FullPath, ug) {
+			continue // Not a group, or not renamed
+		}
+		for _, shared := range sharedGroups {
+			if shared.GroupId == group.Id {
+				renamedGroups = append(renamedGroups, ownerProblem{ug, "group was renamed/moved; update CODEOWNERS to @" + group.FullPath})
+				break
+			}
+		}
+	}
+	return
+}
+
+// Check that each group owner that wasn't found as a member at least exists, so that a typo in a group path
+// is reported as such. Only owners with a "/" (ex: my-group/my-subgroup) are checked, since those can't be
+// usernames. Groups that were already reported as renamed are skipped.
+func checkGroupsExist(eChecker groupExistenceChecker, ugLeftovers []string, renamedGroups []ownerProblem) (missingGroups []ownerProblem, err error) {
+	for _, ug := range ugLeftovers {
+		if !strings.Contains(ug, "/") || hasOwnerProblem(renamedGroups, ug) {
+			continue
+		}
+		exists, lookupErr := eChecker.GroupExists(ug)
+		if lookupErr != nil {
+			err = fmt.Errorf("checkGroupsExist() errored in eChecker.GroupExists(): %w", lookupErr)
+			return
+		}
+		if !exists {
+			missingGroups = append(missingGroups, ownerProblem{ug, "group does not exist or is not visible to the token"})
+		}
+	}
+	return
+}
+
+// Classify each user/group owner that wasn't found as a member (and that can't only be a group, since it has no
+// "/") as either nonexistent, or as an existing user or group that just isn't a direct member of the project.
+// Groups that were already reported as renamed are skipped.
+func classifyOwnerLeftovers(oChecker ownerExistenceChecker, ugLeftovers []string, renamedGroups []ownerProblem) (
+	nonexistentOwners []ownerProblem,
+	nonMemberOwners []ownerProblem,
+	err error,
+) {
+	var names []string
+	for _, ug := range ugLeftovers {
+		if !strings.Contains(ug, "/") && !hasOwnerProblem(renamedGroups, ug) {
+			names = append(names, ug)
+		}
+	}
+	usernamesFound, err := oChecker.CheckForGitLabUsers(names)
+	if err != nil {
+		err = fmt.Errorf("classifyOwnerLeftovers() errored in oChecker.CheckForGitLabUsers(): %w", err)
+		return
+	}
+	for _, name := range names {
+		if slices.ContainsFunc(usernamesFound, func(u string) bool { return strings.EqualFold(u, name) }) {
+			nonMemberOwners = append(nonMemberOwners, ownerProblem{name, "user"})
+			continue
+		}
+		isGroup, lookupErr := oChecker.GroupExists(name)
+		if lookupErr != nil {
+			err = fmt.Errorf("classifyOwnerLeftovers() errored in oChecker.GroupExists(): %w", lookupErr)
+			return
+		}
+		if isGroup {
+			nonMemberOwners = append(nonMemberOwners, ownerProblem{name, "group"})
+		} else {
+			nonexistentOwners = append(nonexistentOwners, ownerProblem{owner: name})
+		}
+	}
+	return
+}
+
+// Return the owner leftovers that weren't reported by any of the more specific checks
+func removeClassifiedOwners(ugLeftovers []string, classifiedOwners ...[]ownerProblem) (unclassified []string) {
+	allClassified := slices.Concat(classifiedOwners...)
+	for _, ug := range ugLeftovers {
+		if !hasOwnerProblem(allClassified, ug) {
+			unclassified = append(unclassified, ug)
+		}
+	}
+	return
+}
+
+// Take the "original" slice and remove all the elements that intersect with the "filterAgainst"
+// slice. Return the new slice.
+func filterSlice(original []string, filterAgainst []string) (filteredList []string) {
+	slog.Debug("filterSlice() is filtering original slice: " + strings.Join(original, " "))
+	// Max size of the filtered output list is the original list size (if no elements intersect)
+	filteredList = make([]string, 0, len(original))
+	// Check each element of the original list against the filterAgainst list
+	for _, originalElement := range original {
+		intersect := slices.IndexFunc(filterAgainst, func(e string) bool {
+			return e == originalElement
+		})
+		// If this element is not in filterAgainst, then keep it
+		if intersect == -1 {
+			filteredList = append(filteredList, originalElement)
+		}
+	}
+	return
+}
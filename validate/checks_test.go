@@ -0,0 +1,362 @@
+package validate
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"gitlab.com/tedspinks/validate-codeowners/analysis"
+	"gitlab.com/tedspinks/validate-codeowners/rest"
+	"gitlab.com/tedspinks/validate-codeowners/testutil"
+)
+
+func TestCheckOwners(t *testing.T) {
+	graphqlServer, restServer := fakeServers(startFakeGitLab(t))
+	tests := []struct {
+		name            string
+		ugList          []string
+		emailList       []string
+		groupPrefix     string
+		wantUsersGroups []string
+		wantEmails      []string
+	}{
+		{
+			name:      "all found",
+			ugList:    []string{"alice", "bob", "dave", "my-group/team"},
+			emailList: []string{"alice@example.com"},
+		},
+		{
+			name:            "some missing",
+			ugList:          []string{"alice", "ghost", "my-group/other-team"},
+			emailList:       []string{"Alice@Example.com", "nobody@example.com"},
+			wantUsersGroups: []string{"ghost", "my-group/other-team"},
+			wantEmails:      []string{"nobody@example.com"},
+		},
+		{
+			name:            "group without its prefix",
+			ugList:          []string{"team", "other-team"},
+			groupPrefix:     "my-group",
+			wantUsersGroups: []string{"other-team"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &validator{}
+			remainingUsersGroups, remainingEmails, err := v.checkOwners(graphqlServer, restServer, "my-group/my-project",
+				tt.ugList, tt.emailList, tt.groupPrefix)
+			if err != nil {
+				t.Fatalf("checkOwners() error = %v", err)
+			}
+			if !slices.Equal(remainingUsersGroups, tt.wantUsersGroups) {
+				t.Errorf("checkOwners() remaining users and groups = %v, want %v", remainingUsersGroups, tt.wantUsersGroups)
+			}
+			if !slices.Equal(remainingEmails, tt.wantEmails) {
+				t.Errorf("checkOwners() remaining emails = %v, want %v", remainingEmails, tt.wantEmails)
+			}
+		})
+	}
+}
+
+func TestFilterGroups(t *testing.T) {
+	tests := []struct {
+		name        string
+		original    []string
+		groupsFound []string
+		want        []string
+	}{
+		{"exact match", []string{"acme/platform"}, []string{"acme/platform"}, []string{}},
+		{"mixed case", []string{"acme/platform"}, []string{"acme/Platform"}, []string{}},
+		{"mixed case owner", []string{"ACME/Platform"}, []string{"acme/platform"}, []string{}},
+		{"surrounding slashes", []string{"/acme/platform/"}, []string{"acme/platform"}, []string{}},
+		{"found with slashes", []string{"acme/platform"}, []string{"/Acme/Platform/"}, []string{}},
+		{"subgroup isn't its parent", []string{"acme/platform/infra"}, []string{"acme/platform"},
+			[]string{"acme/platform/infra"}},
+		{"original casing is kept", []string{"Acme/Missing", "acme/platform"}, []string{"acme/platform"},
+			[]string{"Acme/Missing"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := filterGroups(tt.original, tt.groupsFound); !slices.Equal(got, tt.want) {
+				t.Errorf("filterGroups(%v, %v) = %v, want %v", tt.original, tt.groupsFound, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddUnprefixedGroups(t *testing.T) {
+	tests := []struct {
+		name        string
+		groups      []string
+		groupPrefix string
+		want        []string
+	}{
+		{"no prefix", []string{"acme/platform"}, "", []string{"acme/platform"}},
+		{"prefix", []string{"acme/platform"}, "acme", []string{"acme/platform", "platform"}},
+		{"prefix with slashes", []string{"acme/platform"}, "/acme/", []string{"acme/platform", "platform"}},
+		{"mixed case prefix", []string{"Acme/Platform"}, "acme", []string{"Acme/Platform", "Platform"}},
+		{"nested prefix", []string{"acme/eng/platform", "acme/sales"}, "acme/eng",
+			[]string{"acme/eng/platform", "acme/sales", "platform"}},
+		{"prefix isn't a path segment", []string{"acme-eng/platform"}, "acme", []string{"acme-eng/platform"}},
+		{"the prefix group itself", []string{"acme"}, "acme", []string{"acme"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := addUnprefixedGroups(tt.groups, tt.groupPrefix); !slices.Equal(got, tt.want) {
+				t.Errorf("addUnprefixedGroups(%v, %q) = %v, want %v", tt.groups, tt.groupPrefix, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterEmails(t *testing.T) {
+	tests := []struct {
+		name          string
+		original      []string
+		filterAgainst []string
+		want          []string
+	}{
+		{"same casing", []string{"alice@example.com"}, []string{"alice@example.com"}, []string{}},
+		{"mixed case domain", []string{"alice@Example.COM"}, []string{"alice@example.com"}, []string{}},
+		{"mixed case address", []string{"Alice@Example.com"}, []string{"alice@example.com"}, []string{}},
+		{"original casing is kept", []string{"Nobody@Example.com"}, []string{"alice@example.com"},
+			[]string{"Nobody@Example.com"}},
+		{"dots aren't ignored", []string{"a.lice@example.com"}, []string{"alice@example.com"},
+			[]string{"a.lice@example.com"}},
+		{"tags aren't ignored", []string{"alice+ci@example.com"}, []string{"alice@example.com"},
+			[]string{"alice+ci@example.com"}},
+		{"other domain", []string{"alice@example.org"}, []string{"alice@example.com"}, []string{"alice@example.org"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := filterEmails(tt.original, tt.filterAgainst); !slices.Equal(got, tt.want) {
+				t.Errorf("filterEmails(%v, %v) = %v, want %v", tt.original, tt.filterAgainst, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckSectionApprovalsCountsEmailsOnce(t *testing.T) {
+	co := analysis.New("")
+	co.LoadContent("[Docs][2] Alice@Example.com\n*.md alice@example.com\n")
+	co.Analyze()
+
+	unsatisfiableSections, _ := checkSectionApprovals(co.Sections)
+	want := []string{"[Docs][2] on line 1 requires 2 approvals, but has 1 owners"}
+	if !slices.Equal(unsatisfiableSections, want) {
+		t.Errorf("checkSectionApprovals() = %v, want %v", unsatisfiableSections, want)
+	}
+}
+
+func TestCheckSectionApprovalsCountsOwnersInAnyCaseOnce(t *testing.T) {
+	co := analysis.New("")
+	co.LoadContent("[Docs][4] @alice @My-Group/Team\n*.md @Alice @my-group/team @bob\n")
+	co.Analyze()
+
+	unsatisfiableSections, _ := checkSectionApprovals(co.Sections)
+	want := []string{"[Docs][4] on line 1 requires 4 approvals, but has 3 owners"}
+	if !slices.Equal(unsatisfiableSections, want) {
+		t.Errorf("checkSectionApprovals() = %v, want %v", unsatisfiableSections, want)
+	}
+}
+
+func TestCheckFilePatternsCaseMismatchInRepoFiles(t *testing.T) {
+	repoFiles := []string{"docs/README.md", "src/main.go"}
+	tests := []struct {
+		name               string
+		caseSensitive      bool
+		wantBadPatterns    []string
+		wantCaseMismatches []string
+	}{
+		{"case sensitive", true, nil, []string{"/Docs/* (in the repo: docs/README.md)"}},
+		{"not case sensitive", false, []string{"/Docs/*"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			badPatterns, caseMismatches, err := checkFilePatterns(context.Background(), "/repo",
+				[]string{"/Docs/*", "/src/*.go", "/missing/"}, repoFiles, tt.caseSensitive, "")
+			if err != nil {
+				t.Fatalf("checkFilePatterns() error = %v", err)
+			}
+			if want := append(tt.wantBadPatterns, "/missing/"); !slices.Equal(badPatterns, want) {
+				t.Errorf("checkFilePatterns() badPatterns = %v, want %v", badPatterns, want)
+			}
+			if !slices.Equal(caseMismatches, tt.wantCaseMismatches) {
+				t.Errorf("checkFilePatterns() caseMismatches = %v, want %v", caseMismatches, tt.wantCaseMismatches)
+			}
+		})
+	}
+}
+
+func TestMatchInMemoryWithCaseSensitiveGlob(t *testing.T) {
+	gitlab := startFakeGitLab(t)
+	repoRoot := newTestRepo(t, "/Docs/* @alice\n", "docs/README.md")
+	cfg := testConfig(gitlab, repoRoot)
+	cfg.MatchInMemory = true
+	cfg.CaseSensitiveGlob = true
+
+	report, err := Validate(cfg)
+	if err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	want := []string{"/Docs/* (in the repo: docs/README.md)"}
+	if got := findingValues(findCheck(t, report, "File pattern case check")); !slices.Equal(got, want) {
+		t.Errorf("File pattern case check findings = %v, want %v", got, want)
+	}
+	if got := findingValues(findCheck(t, report, "File pattern check")); len(got) > 0 {
+		t.Errorf("File pattern check findings = %v, want none, since it's a case mismatch", got)
+	}
+}
+
+func TestCheckApprovalSetting(t *testing.T) {
+	_, restServer := fakeServers(startFakeGitLab(t))
+	tests := []struct {
+		branch       string
+		wantProblems []string
+	}{
+		{"main", nil},
+		{"release/1.0", nil},
+		{"stable/1.0", nil}, // Required by the exact name, even though the wildcard doesn't require it
+		{"stable/2.0", []string{"branch 'stable/2.0' is protected by 'stable/*', but 'Require approval from code owners' is not enabled"}},
+		{"develop", []string{"branch 'develop' is not protected, so code owner approval cannot be required"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.branch, func(t *testing.T) {
+			problems, err := checkApprovalSetting(restServer, "my-group/my-project", tt.branch)
+			if err != nil {
+				t.Fatalf("checkApprovalSetting() error = %v", err)
+			}
+			if !slices.Equal(problems, tt.wantProblems) {
+				t.Errorf("checkApprovalSetting() = %v, want %v", problems, tt.wantProblems)
+			}
+		})
+	}
+}
+
+func TestMissingOwnersAreOnlyReportedOnce(t *testing.T) {
+	gitlab := startFakeGitLab(t)
+	repoRoot := newTestRepo(t, "*.md @alice @ghost @my-group/typo\n", "README.md")
+
+	report, err := Validate(testConfig(gitlab, repoRoot))
+	if err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	tests := []struct {
+		check      string
+		want       []string
+		wantDetail string
+	}{
+		{"Direct user and group membership check", nil, ""},
+		{"Nonexistent owner check", []string{"ghost"}, ""},
+		{"Group existence check", []string{"my-group/typo"}, "group does not exist or is not visible to the token"},
+	}
+	for _, tt := range tests {
+		check := findCheck(t, report, tt.check)
+		if got := findingValues(check); !slices.Equal(got, tt.want) {
+			t.Errorf("%v findings = %v, want %v", tt.check, got, tt.want)
+		}
+		// Each finding is located by its owner's lines
+		for _, finding := range check.Findings {
+			if !slices.Equal(finding.Lines, []int{1}) || finding.Detail != tt.wantDetail {
+				t.Errorf("%v finding = %+v, want it on line 1, with the detail %q", tt.check, finding, tt.wantDetail)
+			}
+		}
+	}
+}
+
+func TestCheckGroupsExist(t *testing.T) {
+	graphqlServer, _ := fakeServers(startFakeGitLab(t))
+	ugLeftovers := []string{"alice", "my-group/team", "my-group/typo", "my-group/old-name"}
+	renamedGroups := []ownerProblem{{"my-group/old-name", "group was renamed/moved; update CODEOWNERS to @my-group/new-name"}}
+
+	missingGroups, err := checkGroupsExist(graphqlServer, ugLeftovers, renamedGroups)
+	if err != nil {
+		t.Fatalf("checkGroupsExist() error = %v", err)
+	}
+	// alice can't be a group, and my-group/old-name was already reported as renamed
+	want := []ownerProblem{{"my-group/typo", "group does not exist or is not visible to the token"}}
+	if !slices.Equal(missingGroups, want) {
+		t.Errorf("checkGroupsExist() = %v, want %v", missingGroups, want)
+	}
+}
+
+func TestClassifyOwnerLeftovers(t *testing.T) {
+	gitlab := &testutil.GitLab{
+		Users:  []rest.Member{{Id: 3, Username: "carol"}},
+		Groups: []rest.GroupDetails{{Id: 20, Name: "platform", FullPath: "platform"}},
+	}
+	gitlab.Start()
+	defer gitlab.Close()
+	graphqlServer, _ := fakeServers(gitlab)
+	ugLeftovers := []string{"carol", "ghost", "platform", "my-group/typo", "old-name"}
+	renamedGroups := []ownerProblem{{"old-name", "group was renamed/moved; update CODEOWNERS to @new-name"}}
+
+	// my-group/typo can only be a group, and old-name was already reported as renamed
+	nonexistentOwners, nonMemberOwners, err := classifyOwnerLeftovers(graphqlServer, ugLeftovers, renamedGroups)
+	if err != nil {
+		t.Fatalf("classifyOwnerLeftovers() error = %v", err)
+	}
+	if want := []ownerProblem{{owner: "ghost"}}; !slices.Equal(nonexistentOwners, want) {
+		t.Errorf("classifyOwnerLeftovers() nonexistent owners = %v, want %v", nonexistentOwners, want)
+	}
+	if want := []ownerProblem{{"carol", "user"}, {"platform", "group"}}; !slices.Equal(nonMemberOwners, want) {
+		t.Errorf("classifyOwnerLeftovers() non-member owners = %v, want %v", nonMemberOwners, want)
+	}
+}
+
+func TestCheckDeniedOwners(t *testing.T) {
+	ownerLines := map[string][]int{
+		"Deprecated-Group":  {2},
+		"deprecated-group":  {5},
+		"alice":             {1, 3},
+		"old@example.com":   {4},
+		"my-group/old-team": {6},
+	}
+	tests := []struct {
+		name         string
+		deniedOwners []string
+		want         []string
+	}{
+		{"none denied", []string{"bob", "@my-group/team"}, nil},
+		{"with and without @", []string{"@alice", " old@example.com "}, []string{"alice on lines: 1, 3", "old@example.com on lines: 4"}},
+		{"any casing", []string{"deprecated-group"}, []string{"Deprecated-Group on lines: 2", "deprecated-group on lines: 5"}},
+		{"mixed case denylist", []string{"@My-Group/Old-Team", "ALICE"}, []string{"my-group/old-team on lines: 6", "alice on lines: 1, 3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := checkDeniedOwners(ownerLines, tt.deniedOwners); !slices.Equal(got, tt.want) {
+				t.Errorf("checkDeniedOwners(%v) = %v, want %v", tt.deniedOwners, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckDirectoryPatternsInRepoFiles(t *testing.T) {
+	repoFiles := []string{"src/app/main.go", "src/app/util.go", "src/lib/lib.go", "docs/README.md"}
+	patterns := []string{"/src/app", "/src/app/main.go", "/src/app/", "/docs/*", "lib", "/missing"}
+	got, err := checkDirectoryPatterns("/repo", patterns, repoFiles)
+	if err != nil {
+		t.Fatalf("checkDirectoryPatterns() error = %v", err)
+	}
+	if want := []string{"/src/app", "lib"}; !slices.Equal(got, want) {
+		t.Errorf("checkDirectoryPatterns() = %v, want %v", got, want)
+	}
+}
+
+func TestCheckInvitedGroupAccessMatchesGroupOwnersInAnyCase(t *testing.T) {
+	gitlab := &testutil.GitLab{
+		Projects: map[string]rest.Project{"my-group/my-project": {Id: 100, PathWithNamespace: "my-group/my-project",
+			SharedWithGroups: []rest.Group{{GroupId: 10, GroupName: "team", GroupFullPath: "my-group/team", GroupAccessLevel: rest.ReporterAccess}}}},
+		GroupMembers: map[int][]rest.Member{10: {{Id: 4, Username: "dave"}}},
+	}
+	gitlab.Start()
+	defer gitlab.Close()
+	_, restServer := fakeServers(gitlab)
+
+	lowAccessOwners, err := checkInvitedGroupAccess(restServer, "my-group/my-project", []string{"My-Group/Team"}, nil)
+	if err != nil {
+		t.Fatalf("checkInvitedGroupAccess() error = %v", err)
+	}
+	if want := []string{"my-group/team (the group is shared with Reporter access)"}; !slices.Equal(lowAccessOwners, want) {
+		t.Errorf("checkInvitedGroupAccess() = %v, want %v", lowAccessOwners, want)
+	}
+}
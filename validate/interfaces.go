@@ -0,0 +1,71 @@
+package validate
+
+import (
+	"gitlab.com/tedspinks/validate-codeowners/graphql"
+	"gitlab.com/tedspinks/validate-codeowners/rest"
+)
+
+type syntaxChecker interface {
+	CheckCodeownersSyntax(codeownersPath string, projectPath string, branch string) (err error)
+}
+
+type groupChecker interface {
+	GetDirectGroupMembers(projectFullPath string) (groups []string, err error)
+}
+
+type userChecker interface {
+	GetDirectUserMembers(projectFullPath string, userSource string) (usernamesFound []string, emailsFound []string, err error)
+}
+
+type groupRenameChecker interface {
+	GetSharedGroups(projectFullPath string) (groups []rest.Group, err error)
+	GetGroupByPath(groupFullPath string) (group *rest.GroupDetails, err error)
+}
+
+type approvalSettingChecker interface {
+	GetProtectedBranches(projectFullPath string) (protectedBranches []rest.ProtectedBranch, err error)
+}
+
+type tokenChecker interface {
+	CheckTokenAccess(projectFullPath string) (user *rest.User, err error)
+}
+
+type approverCapacityChecker interface {
+	GetGroupByPath(groupFullPath string) (group *rest.GroupDetails, err error)
+	GetGroupMembers(groupId int) (members []rest.Member, err error)
+}
+
+type invitedAccessChecker interface {
+	GetSharedGroups(projectFullPath string) (groups []rest.Group, err error)
+	GetGroupMembers(groupId int) (members []rest.Member, err error)
+	GetDirectUserMembers(projectFullPath string, userSource string) (usernamesFound []string, emailsFound []string, err error)
+}
+
+type groupVisibilityChecker interface {
+	GetGroupByFullPath(fullPath string) (group *graphql.Group, err error)
+}
+
+type subgroupResolver interface {
+	GetDescendantGroups(fullPath string) (descendants []string, err error)
+}
+
+type groupExistenceChecker interface {
+	GroupExists(fullPath string) (exists bool, err error)
+}
+
+type ownerExistenceChecker interface {
+	CheckForGitLabUsers(usernames []string) (usernamesFound []string, err error)
+	GroupExists(fullPath string) (exists bool, err error)
+}
+
+type mergeRequestChecker interface {
+	GetMergeRequest(projectFullPath string, mergeRequestIid int) (mergeRequest *rest.MergeRequest, err error)
+}
+
+type graphqlPinger interface {
+	Ping() (username string, err error)
+}
+
+type restPinger interface {
+	GetVersion() (version *rest.Version, err error)
+}
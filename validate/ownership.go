@@ -0,0 +1,64 @@
+package validate
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"gitlab.com/tedspinks/validate-codeowners/analysis"
+)
+
+// Return the sections with only the entries for the specified file patterns, ex: the ones that a merge request
+// changed. Sections without any of those entries are left out.
+func filterSectionEntries(sections []analysis.Section, filePatterns []string) (filtered []analysis.Section) {
+	for _, section := range sections {
+		section.Entries = slices.DeleteFunc(slices.Clone(section.Entries), func(entry analysis.Entry) bool {
+			return !slices.Contains(filePatterns, entry.FilePattern)
+		})
+		if len(section.Entries) > 0 {
+			filtered = append(filtered, section)
+		}
+	}
+	return
+}
+
+// Write a report of the effective owners of each file pattern, in file order, so that reviewers can eyeball
+// who owns what. An entry without its own owners is owned by its section's default owners. File patterns
+// aren't matched against the repo's files, so this just reflects the structure of the CODEOWNERS file.
+func WriteOwnershipReport(reportPath string, sections []analysis.Section) (err error) {
+	var ownership strings.Builder
+	for _, section := range sections {
+		heading := "[" + section.Name + "]"
+		if section.Heading == "" {
+			heading = "(no section)"
+		}
+		var notes []string
+		if section.Optional {
+			notes = append(notes, "optional")
+		}
+		if section.ApprovalCount > 0 {
+			notes = append(notes, fmt.Sprintf("%d approvals", section.ApprovalCount))
+		}
+		if len(notes) > 0 {
+			heading += " (" + strings.Join(notes, ", ") + ")"
+		}
+		fmt.Fprintln(&ownership, heading)
+		for _, entry := range section.Entries {
+			owners := strings.Join(entry.Owners, " ")
+			switch {
+			case len(entry.Owners) == 0 && len(section.DefaultOwners) == 0:
+				owners = "(no owners)"
+			case len(entry.Owners) == 0:
+				owners = strings.Join(section.DefaultOwners, " ") + " (default owners)"
+			}
+			fmt.Fprintf(&ownership, "     %v  %v\n", entry.FilePattern, owners)
+		}
+		fmt.Fprintln(&ownership)
+	}
+	err = os.WriteFile(reportPath, []byte(ownership.String()), 0644)
+	if err != nil {
+		err = fmt.Errorf("WriteOwnershipReport() unable to write to '%v': %w", reportPath, err)
+	}
+	return
+}
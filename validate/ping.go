@@ -0,0 +1,73 @@
+package validate
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gitlab.com/tedspinks/validate-codeowners/transport"
+)
+
+// The result of pinging one of GitLab's APIs
+type PingResult struct {
+	Api        string        // "GraphQL" or "REST"
+	Url        string        // The API's URL, ex: cfg.GitlabGraphqlUrl
+	Reachable  bool          // The API answered, even if it rejected the token
+	TokenValid bool          // The API accepted the token, and knew whose it was
+	Latency    time.Duration // How long the API took to answer (or to fail)
+	Detail     string        // The token's username (GraphQL) or GitLab's version (REST), or else what went wrong
+}
+
+// Check that both of GitLab's APIs are reachable, and that they accept the token, with one cheap request to
+// each. Handy before a big run, to tell configuration and network problems apart from CODEOWNERS problems.
+// Only returns an error if the connections can't be set up, ex: for a malformed GITLAB_PROXY_URL.
+func Ping(cfg Config) (results []PingResult, err error) {
+	graphqlServer, restServer, err := SetupGitlabConnections(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("Ping() errored in SetupGitlabConnections(): %w", err)
+	}
+	results = append(results, pingGraphQl(graphqlServer, cfg.GitlabGraphqlUrl), pingRest(restServer, cfg.GitlabRestUrl))
+	return results, nil
+}
+
+// Query the GraphQL API for __typename and the token's user. GraphQL allows anonymous requests, so a missing
+// token is only noticed by currentUser being null.
+func pingGraphQl(pinger graphqlPinger, url string) (result PingResult) {
+	result = PingResult{Api: "GraphQL", Url: url}
+	start := time.Now()
+	username, err := pinger.Ping()
+	result.Latency = time.Since(start)
+	switch {
+	case errors.Is(err, transport.ErrTokenRejected):
+		result.Reachable = true
+		result.Detail = "GitLab rejected the token"
+	case err != nil:
+		result.Detail = err.Error()
+	case username == "":
+		result.Reachable = true
+		result.Detail = "GitLab treated the request as anonymous, so the token is missing"
+	default:
+		result.Reachable, result.TokenValid = true, true
+		result.Detail = "user '" + username + "'"
+	}
+	return
+}
+
+// Request the REST API's /version, which requires authentication
+func pingRest(pinger restPinger, url string) (result PingResult) {
+	result = PingResult{Api: "REST", Url: url}
+	start := time.Now()
+	version, err := pinger.GetVersion()
+	result.Latency = time.Since(start)
+	switch {
+	case errors.Is(err, transport.ErrTokenRejected):
+		result.Reachable = true
+		result.Detail = "GitLab rejected the token"
+	case err != nil:
+		result.Detail = err.Error()
+	default:
+		result.Reachable, result.TokenValid = true, true
+		result.Detail = "GitLab version " + version.Version
+	}
+	return
+}
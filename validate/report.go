@@ -0,0 +1,189 @@
+package validate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"gitlab.com/tedspinks/validate-codeowners/analysis"
+)
+
+// Statuses of a CheckResult
+const (
+	StatusPassed  = "PASSED"
+	StatusFailed  = "FAILED"
+	StatusWarning = "WARNING"
+	StatusSkipped = "SKIPPED"
+)
+
+// Version of the JSON report schema below. Bump it for any change that isn't backwards compatible.
+const ReportSchemaVersion = 1
+
+// The JSON report, which CODEOWNERS_JSON_REPORT writes and CODEOWNERS_MERGE_REPORTS reads. Checks are
+// identified by name, and findings by fingerprint, so that reports from separate runs merge unambiguously.
+type Report struct {
+	SchemaVersion int           `json:"schemaVersion"`
+	Passed        bool          `json:"passed"`
+	ExitCode      int           `json:"exitCode"`
+	Checks        []CheckResult `json:"checks"`
+	Timings       []PhaseTiming `json:"-"`               // In the order that the phases finished
+	Notes         []string      `json:"notes,omitempty"` // Informational, ex: what the token can search for
+	Summary       Summary       `json:"summary"`
+	// What was parsed from the CODEOWNERS file, or nil if it couldn't be located
+	Codeowners *analysis.CodeownersFileAnatomy `json:"-"`
+}
+
+// Counts of the checks by status, and of the owners that the membership checks looked up, for an at-a-glance
+// result of the run
+type Summary struct {
+	Passed         int `json:"passed"`
+	Failed         int `json:"failed"`
+	Warnings       int `json:"warnings"`
+	Skipped        int `json:"skipped"`
+	OwnersVerified int `json:"ownersVerified"` // Found as direct members of the project
+	OwnersMissing  int `json:"ownersMissing"`
+}
+
+// Wall-clock duration of one phase of the run, ex: the syntax check
+type PhaseTiming struct {
+	Phase    string
+	Duration time.Duration
+}
+
+type CheckResult struct {
+	Name     string    `json:"name"`
+	Status   string    `json:"status"`
+	ExitCode int       `json:"exitCode"` // 0 if the check passed
+	Error    string    `json:"error,omitempty"`
+	Message  string    `json:"message,omitempty"` // Describes the findings, ex: "Unable to find:"
+	Findings []Finding `json:"findings"`
+}
+
+// A single problem reported by a check. The fingerprint stays the same from run to run as long as the
+// underlying problem is unchanged, so that downstream tools can use it for deduplication and suppression.
+type Finding struct {
+	Check       string `json:"check"`
+	Value       string `json:"value"`
+	File        string `json:"file"`
+	Lines       []int  `json:"lines,omitempty"`
+	Detail      string `json:"detail,omitempty"` // Explains the finding, ex: the path that a renamed group moved to
+	Fingerprint string `json:"fingerprint"`
+}
+
+// Return the finding as it's printed, i.e. its value, followed by its detail (if any) in parentheses
+func (f Finding) String() string {
+	if f.Detail == "" {
+		return f.Value
+	}
+	return f.Value + " (" + f.Detail + ")"
+}
+
+// Return the exit code of the most severe failed check, or ExitCodeSuccess if all checks passed. Internal
+// errors are the most severe, followed by the check categories in the order of their exit codes.
+func (r Report) MostSevereExitCode() (exitCode int) {
+	exitCode = ExitCodeSuccess
+	for _, check := range r.Checks {
+		if check.ExitCode != ExitCodeSuccess && (exitCode == ExitCodeSuccess || check.ExitCode < exitCode) {
+			exitCode = check.ExitCode
+		}
+	}
+	return
+}
+
+// Return the summary with the checks counted by status. The owner counts are kept from r.Summary, since they're
+// recorded when the owners are checked (and added up when reports are merged).
+func (r Report) Summarize() (summary Summary) {
+	summary = Summary{OwnersVerified: r.Summary.OwnersVerified, OwnersMissing: r.Summary.OwnersMissing}
+	for _, check := range r.Checks {
+		switch check.Status {
+		case StatusPassed:
+			summary.Passed++
+		case StatusFailed:
+			summary.Failed++
+		case StatusWarning:
+			summary.Warnings++
+		case StatusSkipped:
+			summary.Skipped++
+		}
+	}
+	return
+}
+
+// Add the owner counts of another run's summary, ex: when merging the reports of separate runs
+func (s *Summary) AddOwners(other Summary) {
+	s.OwnersVerified += other.OwnersVerified
+	s.OwnersMissing += other.OwnersMissing
+}
+
+// Build the result of a check from its error and leftovers (the values that failed the check), which are located
+// in co. A check that fails due to an error gets ExitCodeInternal, otherwise a failed check gets its category's
+// failureExitCode.
+func newCheckResult(co *analysis.CodeownersFileAnatomy, checkName string, failureExitCode int, err error, leftovers []string, leftoverMsg string) (result CheckResult) {
+	result = CheckResult{Name: checkName, Status: StatusPassed, Findings: []Finding{}}
+	if len(leftovers) > 0 || err != nil {
+		result.Status = StatusFailed
+		result.ExitCode = failureExitCode
+	}
+	if err != nil {
+		result.Error = err.Error()
+		result.ExitCode = ExitCodeInternal
+		return
+	}
+	if len(leftovers) > 0 {
+		result.Message = leftoverMsg
+	}
+	for _, leftover := range leftovers {
+		result.Findings = append(result.Findings, newFinding(co, checkName, leftover))
+	}
+	return
+}
+
+// Build the result of a check whose leftovers are owner problems, which is just like newCheckResult(), except that
+// each finding's value is the owner, so that it's located by the owner's lines, and it keeps the problem's detail
+func newOwnerProblemResult(co *analysis.CodeownersFileAnatomy, checkName string, failureExitCode int, err error, problems []ownerProblem, leftoverMsg string) (result CheckResult) {
+	owners := make([]string, 0, len(problems))
+	for _, problem := range problems {
+		owners = append(owners, problem.owner)
+	}
+	result = newCheckResult(co, checkName, failureExitCode, err, owners, leftoverMsg)
+	for i := range result.Findings {
+		result.Findings[i].Detail = problems[i].detail
+	}
+	return
+}
+
+// Build the result of a warning check, which is just like newCheckResult(), except that it only fails the run
+// if treatWarningsAsFailures is set. Otherwise, any leftovers (or error) give it a status of WARNING.
+func newWarningResult(co *analysis.CodeownersFileAnatomy, checkName string, err error, leftovers []string, leftoverMsg string, treatWarningsAsFailures bool) (result CheckResult) {
+	result = newCheckResult(co, checkName, ExitCodeWarning, err, leftovers, leftoverMsg)
+	if result.Status == StatusFailed && !treatWarningsAsFailures {
+		result.Status = StatusWarning
+		result.ExitCode = ExitCodeSuccess
+	}
+	return
+}
+
+// Build a finding for the specified check and value (an owner or file pattern), located in the CODEOWNERS file.
+// co is nil if the finding came before the CODEOWNERS file was located, in which case it has no location.
+func newFinding(co *analysis.CodeownersFileAnatomy, checkName string, value string) Finding {
+	finding := Finding{
+		Check: checkName,
+		Value: value,
+	}
+	if co != nil {
+		finding.File = co.CodeownersFilePath
+		finding.Lines = co.OwnerLines[value]
+		if finding.Lines == nil {
+			finding.Lines = co.FilePatternLines[value]
+		}
+	}
+	finding.Fingerprint = fingerprint(finding)
+	return finding
+}
+
+// Return a stable hash of the finding's type (check), value, file, and location (lines)
+func fingerprint(f Finding) string {
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%v\x00%v\x00%v\x00%v", f.Check, f.Value, f.File, f.Lines)))
+	return hex.EncodeToString(hash[:16])
+}
@@ -0,0 +1,119 @@
+package validate
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/bmatcuk/doublestar"
+)
+
+// Return the repo's files that aren't matched by any of the CODEOWNERS file patterns, i.e. the inverse of
+// checkFilePatterns(). A directory whose files are all unowned is returned as the directory (ex: "docs/"), rather
+// than as each of its files. Files that match one of the ignoredPaths globs (ex: "vendor/**") are skipped. If
+// repoFiles is nil, then the files are found by walking the working tree under repoRoot.
+func findUnownedFiles(repoRoot string, filePatterns []string, repoFiles []string, ignoredPaths []string) (unowned []string, err error) {
+	if repoFiles == nil {
+		repoFiles, err = listWorkingTreeFiles(repoRoot)
+		if err != nil {
+			err = fmt.Errorf("findUnownedFiles(): %w", err)
+			return
+		}
+	}
+	globs := make([]string, 0, len(filePatterns))
+	for _, pattern := range filePatterns {
+		globs = append(globs, TranslateCoToGlob(repoRoot, pattern))
+	}
+	root := filepath.ToSlash(filepath.Clean(repoRoot))
+	dirFileCounts := map[string]int{}    // Directory -> number of files under it (recursively)
+	dirUnownedCounts := map[string]int{} // Directory -> number of unowned files under it (recursively)
+	var unownedFiles []string
+	for _, file := range repoFiles {
+		ignored, matchErr := matchesAny(ignoredPaths, file)
+		if matchErr != nil {
+			err = fmt.Errorf("findUnownedFiles() error while evaluating the ignore list: %w", matchErr)
+			return
+		}
+		if ignored {
+			continue
+		}
+		owned, matchErr := matchesAny(globs, root+"/"+file)
+		if matchErr != nil {
+			err = fmt.Errorf("findUnownedFiles() error while evaluating the file patterns: %w", matchErr)
+			return
+		}
+		for dir := path.Dir(file); dir != "."; dir = path.Dir(dir) {
+			dirFileCounts[dir]++
+			if !owned {
+				dirUnownedCounts[dir]++
+			}
+		}
+		if !owned {
+			unownedFiles = append(unownedFiles, file)
+		}
+	}
+	// Collapse each unowned file into its highest directory that is entirely unowned
+	for _, file := range unownedFiles {
+		reported := file
+		for dir := path.Dir(file); dir != "."; dir = path.Dir(dir) {
+			if dirUnownedCounts[dir] == dirFileCounts[dir] {
+				reported = dir + "/"
+			}
+		}
+		if !slices.Contains(unowned, reported) {
+			unowned = append(unowned, reported)
+		}
+	}
+	slices.Sort(unowned)
+	return
+}
+
+// Return true if the name matches any of the glob expressions
+func matchesAny(globs []string, name string) (matched bool, err error) {
+	for _, glob := range globs {
+		matched, err = doublestar.Match(glob, name)
+		if err != nil || matched {
+			return
+		}
+	}
+	return false, nil
+}
+
+// Return the paths of all the files in the working tree, relative to repoRoot (ex: "docs/README.md"), just
+// like git lists them. The .git directory is skipped.
+func listWorkingTreeFiles(repoRoot string) (files []string, err error) {
+	err = filepath.WalkDir(repoRoot, func(filePath string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		relativePath, err := filepath.Rel(repoRoot, filePath)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(relativePath))
+		return nil
+	})
+	if err != nil {
+		err = fmt.Errorf("listWorkingTreeFiles() unable to walk '%v': %w", repoRoot, err)
+	}
+	return
+}
+
+// Read the list of paths that are expected to be unowned, as globs relative to the repo's root (ex: "vendor/**").
+// Blank lines and #comments are skipped.
+func readUnownedIgnoreList(ignoreListPath string) (ignoredPaths []string, err error) {
+	ignoredPaths, err = readListFile(ignoreListPath)
+	for i, ignoredPath := range ignoredPaths {
+		ignoredPaths[i] = strings.TrimPrefix(ignoredPath, "/")
+	}
+	return
+}
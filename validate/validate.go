@@ -0,0 +1,731 @@
+// Package validate runs all of the checks on a project's CODEOWNERS file, and returns their results as a Report,
+// so that the validation can be embedded in other Go tools. It doesn't print anything or exit, which is left to
+// the caller (ex: the validate-codeowners command).
+package validate
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sync"
+	"time"
+
+	"gitlab.com/tedspinks/validate-codeowners/analysis"
+	"gitlab.com/tedspinks/validate-codeowners/gitfiles"
+	"gitlab.com/tedspinks/validate-codeowners/graphql"
+	"gitlab.com/tedspinks/validate-codeowners/ratelimit"
+	"gitlab.com/tedspinks/validate-codeowners/rest"
+	"gitlab.com/tedspinks/validate-codeowners/transport"
+)
+
+// Exit codes. When checks from more than one category fail, the most severe (lowest non-zero) code is used.
+const (
+	ExitCodeSuccess     = 0
+	ExitCodeInternal    = 1 // Usage or internal errors, ex: missing env vars or GitLab API errors
+	ExitCodeSyntax      = 2 // The server-side syntax check failed
+	ExitCodeOwner       = 3 // An owner could not be found (or is otherwise not valid)
+	ExitCodeFilePattern = 4 // A file pattern does not match any files
+	ExitCodeMalformed   = 5 // A malformed entry, ex: an owner that doesn't start with "@"
+	ExitCodeWarning     = 6 // A warning, when CODEOWNERS_STRICT is enabled
+	// Not a check category: the run was interrupted (ex: Ctrl-C), so its results are incomplete. Same as a shell's
+	// exit code for SIGINT.
+	ExitCodeInterrupted = 130
+)
+
+// Max number of lines that the line length check reports, so that a huge generated file doesn't flood the output
+const maxReportedLongLines = 10
+
+// Everything that Validate() needs to know about the GitLab project and which checks to run. The comments note
+// the env var that the validate-codeowners command reads each field from.
+type Config struct {
+	// GitLab connection
+	ProjectPath         string      // CI_PROJECT_PATH
+	Branch              string      // CI_COMMIT_REF_NAME
+	MergeRequestIid     int         // CI_MERGE_REQUEST_IID, 0 if the run isn't for a merge request
+	Author              string      // GITLAB_USER_LOGIN, used if the run isn't for a merge request (ex: for a push)
+	GitlabGraphqlUrl    string      // CI_API_GRAPHQL_URL
+	GitlabRestUrl       string      // CI_API_V4_URL
+	GitlabToken         string      // GITLAB_TOKEN
+	GitlabTokenFallback string      // GITLAB_TOKEN_FALLBACK, to retry a request with if GitlabToken is rejected (401)
+	GitlabTimeout       int         // GITLAB_TIMEOUT_SECS
+	SyntaxTimeout       int         // GITLAB_SYNTAX_TIMEOUT_SECS, for the whole syntax check, 0 to use GitlabTimeout
+	MembersTimeout      int         // GITLAB_MEMBERS_TIMEOUT_SECS, for all the requests that list members, 0 to use GitlabTimeout
+	GitlabProxyUrl      string      // GITLAB_PROXY_URL
+	GitlabExtraHeaders  http.Header // GITLAB_EXTRA_HEADERS, added to every request
+	AllowPartialResults bool        // GITLAB_ALLOW_PARTIAL_RESULTS, to warn about GraphQL errors on specific fields
+	GitlabRateLimit     float64     // GITLAB_RATE_LIMIT, in requests per second, 0 for no limit
+	ApiBackend          string      // CODEOWNERS_API_BACKEND, "graphql" (default) or "rest", for listing members
+	// Optional HTTP transport for the GitLab requests, ex: to share one with other requests. Built from
+	// GitlabProxyUrl if nil.
+	GitlabTransport http.RoundTripper
+
+	// The CODEOWNERS file
+	RepoRoot string // CODEOWNERS_REPO_ROOT
+	// Path of the CODEOWNERS file within RepoRoot (ex: docs/CODEOWNERS), or "" to look in GitLab's supported locations
+	CodeownersPath string
+	Content        []byte // If not nil, used instead of locating the CODEOWNERS file, ex: when it's read from stdin
+	ContentSource  string // Where Content came from, shown in place of the file path, ex: "--content". Defaults to "stdin".
+	StreamParse    bool   // CODEOWNERS_STREAM_PARSE
+
+	// Checks
+	Strict                bool     // CODEOWNERS_STRICT
+	SkipSyntaxCheck       bool     // CODEOWNERS_SKIP_SYNTAX_CHECK
+	GroupPrefix           string   // CODEOWNERS_GROUP_PREFIX
+	DenyOwners            []string // CODEOWNERS_DENY_OWNERS
+	AllowedEmailDomains   []string // CODEOWNERS_ALLOWED_EMAIL_DOMAINS
+	OwnershipReport       string   // CODEOWNERS_OWNERSHIP_REPORT
+	FilePatternIgnore     string   // CODEOWNERS_FILE_PATTERN_IGNORE
+	ExtraLocations        []string // CODEOWNERS_EXTRA_LOCATIONS, checked after GitLab's 3 supported locations
+	CaseSensitiveGlob     bool     // CODEOWNERS_CASE_SENSITIVE_GLOB
+	ExcludeSelfMatch      bool     // CODEOWNERS_EXCLUDE_SELF_MATCH, so that the CODEOWNERS file isn't a file pattern match
+	GlobTimeout           int      // CODEOWNERS_GLOB_TIMEOUT_SECS, for the file pattern check, 0 to use GitlabTimeout
+	MatchInMemory         bool     // CODEOWNERS_MATCH_IN_MEMORY
+	DiffBase              string   // CODEOWNERS_DIFF_BASE, to only check the file patterns that match changed files
+	ReportMatchCounts     bool     // CODEOWNERS_REPORT_MATCH_COUNTS
+	BroadPatternLimit     int      // CODEOWNERS_BROAD_PATTERN_LIMIT, 0 to skip the check
+	ReportUnowned         bool     // CODEOWNERS_REPORT_UNOWNED
+	UnownedIgnore         string   // CODEOWNERS_UNOWNED_IGNORE
+	CheckApprovalSetting  bool     // CODEOWNERS_CHECK_APPROVAL_SETTING
+	EmailStrict           bool     // CODEOWNERS_EMAIL_STRICT, to fail on unknown emails even if the token isn't an admin
+	CheckWhitespace       bool     // CODEOWNERS_CHECK_WHITESPACE
+	CheckSeparator        bool     // CODEOWNERS_CHECK_SEPARATOR
+	CheckOwnerCasing      bool     // CODEOWNERS_CHECK_OWNER_CASING
+	CheckRedundantOwners  bool     // CODEOWNERS_CHECK_REDUNDANT_OWNERS
+	CheckUnusedOwners     bool     // CODEOWNERS_CHECK_UNUSED_OWNERS
+	CheckBotOwners        bool     // CODEOWNERS_CHECK_BOT_OWNERS
+	BotOwnerPattern       string   // CODEOWNERS_BOT_OWNER_PATTERN, a regex for the usernames of bot accounts
+	CheckApproverCapacity bool     // CODEOWNERS_CHECK_APPROVER_CAPACITY
+	CheckInvitedAccess    bool     // CODEOWNERS_CHECK_INVITED_ACCESS
+	CheckGroupVisibility  bool     // CODEOWNERS_CHECK_GROUP_VISIBILITY
+	RequiredParentGroup   string   // CODEOWNERS_REQUIRED_PARENT_GROUP, a group that every owner must belong to
+	ResolveSubgroups      bool     // CODEOWNERS_RESOLVE_SUBGROUPS
+	CheckAuthorOwner      bool     // CODEOWNERS_CHECK_AUTHOR_OWNER, which requires DiffBase
+	MaxLineLength         int      // CODEOWNERS_MAX_LINE_LENGTH
+	MaxEntries            int      // CODEOWNERS_MAX_ENTRIES
+	FailIfEmpty           bool     // CODEOWNERS_FAIL_IF_EMPTY
+
+	// Optional. Called with each check's result as soon as it's recorded, ex: so that the completed checks can be
+	// printed if the run is interrupted.
+	OnResult func(CheckResult)
+}
+
+// Run all of the checks that cfg enables, and return their results in the order that they ran. Checks that
+// fail are recorded in the report, rather than returned as an error. An error is only returned if validation
+// couldn't run to completion (ex: the CODEOWNERS file can't be found), in which case the report has the results
+// of the checks that ran before the error.
+func Validate(cfg Config) (Report, error) {
+	v := validator{cfg: cfg}
+	err := v.run()
+	v.report.SchemaVersion = ReportSchemaVersion
+	v.report.ExitCode = v.report.MostSevereExitCode()
+	v.report.Passed = v.report.ExitCode == ExitCodeSuccess
+	v.report.Summary = v.report.Summarize()
+	v.report.Codeowners = v.co
+	v.report.Timings = v.timings()
+	return v.report, err
+}
+
+// The state of one Validate() run
+type validator struct {
+	cfg          Config
+	report       Report
+	co           *analysis.CodeownersFileAnatomy // The CODEOWNERS file, once it's located
+	timingsMutex sync.Mutex                      // Some phases run concurrently, ex: the member fetches in checkOwners()
+	phaseTimings []PhaseTiming                   // Only used while holding timingsMutex, and copied into the report at the end
+	tokenIsAdmin bool                            // Whether the token belongs to an admin, which can search for users by private email
+}
+
+func (v *validator) run() (err error) {
+	var repoFiles []string
+	v.co, repoFiles, err = Locate(v.cfg)
+	if err != nil {
+		return
+	}
+	graphqlServer, restServer, err := SetupGitlabConnections(v.cfg)
+	if err != nil {
+		return
+	}
+	// Make sure the token can read the project, since otherwise every owner would be reported as not found
+	if !v.checkTokenAccess(restServer, v.cfg.ProjectPath) {
+		return
+	}
+	// In a merge request pipeline, check the file as the merge request will apply it
+	syntaxRef, targetBranch, mergeRequestAuthor, err := resolveMergeRequestRefs(restServer, v.cfg.ProjectPath, v.cfg.MergeRequestIid, v.cfg.Branch)
+	if err != nil {
+		return
+	}
+	// Make sure codeowners syntax is valid before trying to analyze it
+	syntaxStart := time.Now()
+	syntaxPassed := true
+	if v.cfg.Content != nil {
+		v.recordSkipped("Syntax check", "GitLab can only check the syntax of a file on a branch, and the content was read from "+cmp.Or(v.cfg.ContentSource, "stdin"))
+	} else if v.cfg.SkipSyntaxCheck {
+		v.recordSkipped("Syntax check", "Warning: CODEOWNERS_SKIP_SYNTAX_CHECK is enabled, so GitLab did not validate the syntax")
+	} else {
+		syntaxServer, _, cancelSyntax := withPhaseTimeout(graphqlServer, restServer, cmp.Or(v.cfg.SyntaxTimeout, v.cfg.GitlabTimeout))
+		syntaxPassed = v.checkSyntax(syntaxServer, v.co.CodeownersFilePath, v.cfg.ProjectPath, syntaxRef)
+		cancelSyntax()
+	}
+	v.recordTiming("Syntax check", syntaxStart)
+	if !syntaxPassed {
+		return
+	}
+	// Analyze codeowners file structure
+	err = AnalyzeCodeowners(v.cfg, v.co)
+	if err != nil {
+		return
+	}
+	changedFilePatterns, err := v.changedFilePatterns(v.co.FilePatterns, repoFiles)
+	if err != nil {
+		return
+	}
+	if v.cfg.OwnershipReport != "" {
+		reportSections := v.co.Sections
+		// Only narrow the report in diff mode, since filtering drops the sections with only a heading
+		if v.cfg.DiffBase != "" {
+			reportSections = filterSectionEntries(reportSections, changedFilePatterns)
+		}
+		err = WriteOwnershipReport(v.cfg.OwnershipReport, reportSections)
+		if err != nil {
+			return
+		}
+	}
+	// A file with nothing in it passes every other check, but it's almost always a mistake (ex: a bad merge)
+	if v.cfg.FailIfEmpty {
+		var emptyFiles []string
+		if len(v.co.FilePatterns) == 0 && len(v.co.OwnerLines) == 0 {
+			emptyFiles = append(emptyFiles, v.co.CodeownersFilePath)
+		}
+		v.recordResults("Empty file check", ExitCodeMalformed, nil, emptyFiles, "CODEOWNERS files with no file patterns or owners (ex: only blank lines and comments):")
+	}
+	ignoredLocationsMsg := fmt.Sprintf("CODEOWNERS files that GitLab ignores, since it only uses '%v':", v.co.CodeownersFilePath)
+	v.recordWarnings("Multiple locations check", nil, v.co.IgnoredLocations, ignoredLocationsMsg)
+	v.recordResults("Malformed users and groups check", ExitCodeMalformed, nil, v.co.IgnoredPatterns, "Users or groups that do not start with '@':")
+	v.recordResults("Malformed email check", ExitCodeMalformed, nil, v.co.MalformedEmails, "Emails that are not valid addresses:")
+	wildcardOwners := appendLineNumbers(v.co.OwnerLines, v.co.WildcardOwners)
+	v.recordResults("Unsupported wildcard owner check", ExitCodeMalformed, nil, wildcardOwners, "Owners with wildcards, which GitLab does not expand:")
+	// Role owners (ex: @@developer) are tolerated without being verified, but other "@@" syntaxes aren't documented
+	specialOwners := appendLineNumbers(v.co.OwnerLines, v.co.SpecialOwners)
+	v.recordWarnings("Special owner check", nil, specialOwners, "Owners with an '@@' syntax that GitLab does not document, so they were not verified:")
+	// Check for owners that are not allowed (works offline, since it only uses the parsed owner patterns)
+	if len(v.cfg.DenyOwners) > 0 {
+		deniedOwners := checkDeniedOwners(v.co.OwnerLines, v.cfg.DenyOwners)
+		v.recordResults("Denied owners check", ExitCodeOwner, nil, deniedOwners, "Owners that are not allowed:")
+	}
+	if len(v.cfg.AllowedEmailDomains) > 0 {
+		disallowedEmails := checkEmailDomains(v.co.EmailPatterns, v.co.OwnerLines, v.cfg.AllowedEmailDomains)
+		v.recordWarnings("Email domain check", nil, disallowedEmails, "Emails that are not in an allowed domain:")
+	}
+	if v.cfg.CheckBotOwners {
+		botPattern, compileErr := regexp.Compile(v.cfg.BotOwnerPattern)
+		if compileErr != nil {
+			return fmt.Errorf("CODEOWNERS_BOT_OWNER_PATTERN: %w", compileErr)
+		}
+		botOwners := checkBotOwners(v.co.UserAndGroupPatterns, v.co.OwnerLines, botPattern)
+		v.recordWarnings("Bot owner check", nil, botOwners, "Owners that are bot accounts, which can't review merge requests:")
+	}
+	if v.cfg.CheckWhitespace {
+		whitespaceProblems := v.co.FindWhitespaceProblems()
+		v.recordWarnings("Whitespace check", nil, whitespaceProblems, "Lines with whitespace problems:")
+	}
+	if v.cfg.CheckSeparator {
+		separatorProblems := v.co.FindSeparatorProblems()
+		v.recordWarnings("Separator check", nil, separatorProblems, "Lines that don't separate the file pattern from its owners with a single space:")
+	}
+	if v.cfg.CheckOwnerCasing {
+		inconsistentOwners := checkOwnerCasing(v.co.UserAndGroupPatterns, v.co.OwnerLines)
+		v.recordWarnings("Owner casing check", nil, inconsistentOwners, "Owners that are written with different casing:")
+	}
+	if v.cfg.CheckRedundantOwners {
+		redundantOwners := checkRedundantOwners(v.co.Sections)
+		v.recordWarnings("Redundant owner check", nil, redundantOwners, "Entry owners that are already their section's default owners:")
+	}
+	if v.cfg.CheckUnusedOwners {
+		unusedOwners := checkUnusedOwners(v.co.OwnerFilePatterns, v.co.OwnerLines)
+		v.recordWarnings("Unused owner check", nil, unusedOwners, "Owners that don't apply to any file pattern:")
+	}
+	duplicateSectionNames := make([]string, 0, len(v.co.DuplicateSections))
+	for name := range v.co.DuplicateSections {
+		duplicateSectionNames = append(duplicateSectionNames, name)
+	}
+	slices.Sort(duplicateSectionNames)
+	duplicateSections := appendLineNumbers(v.co.DuplicateSections, duplicateSectionNames)
+	v.recordWarnings("Duplicate section check", nil, duplicateSections, "Sections that are declared more than once:")
+	// Optional sections never block merges, so an impossible approval count in one of them is only a warning
+	unsatisfiableSections, unsatisfiableOptionalSections := checkSectionApprovals(v.co.Sections)
+	v.recordResults("Section approval count check", ExitCodeOwner, nil, unsatisfiableSections, "Sections that require more approvals than they have owners:")
+	v.recordWarnings("Optional section approval count check", nil, unsatisfiableOptionalSections, "Optional sections that require more approvals than they have owners:")
+	if v.cfg.MaxLineLength > 0 {
+		longLines := v.co.FindLongLines(v.cfg.MaxLineLength)
+		msg := fmt.Sprintf("Lines longer than %d characters (longest first):", v.cfg.MaxLineLength)
+		v.recordWarnings("Line length check", nil, longLines[:min(len(longLines), maxReportedLongLines)], msg)
+	}
+	if v.cfg.MaxEntries > 0 {
+		var tooManyEntries []string
+		if entryCount := v.co.EntryCount(); entryCount > v.cfg.MaxEntries {
+			tooManyEntries = append(tooManyEntries, fmt.Sprintf("%d entries, which is more than the limit of %d", entryCount, v.cfg.MaxEntries))
+		}
+		v.recordWarnings("Entry count check", nil, tooManyEntries, "The CODEOWNERS file has too many entries:")
+	}
+	// Set expectations for the email check, since it depends on whether the token can see private emails
+	if len(v.co.EmailPatterns) > 0 {
+		v.report.Notes = append(v.report.Notes, emailSearchNote(v.tokenIsAdmin, v.cfg.EmailStrict))
+	}
+	// Check owners. Member lists can be much slower than the other requests, so they can have their own timeout.
+	ugList := v.co.UserAndGroupPatterns
+	eList := v.co.EmailPatterns
+	membersTimeout := cmp.Or(v.cfg.MembersTimeout, v.cfg.GitlabTimeout)
+	membersGraphqlServer, membersRestServer, cancelMembers := withPhaseTimeout(graphqlServer, restServer, membersTimeout)
+	defer cancelMembers()
+	var uChecker userChecker = membersGraphqlServer
+	if v.cfg.ApiBackend == "rest" {
+		uChecker = membersRestServer
+	}
+	userAndGroupLeftovers, emailLeftovers, checkErr := v.checkOwners(uChecker, membersRestServer, v.cfg.ProjectPath, ugList, eList, v.cfg.GroupPrefix)
+	if errors.Is(checkErr, rest.ErrProjectNotFound) {
+		// Every owner would fail as a non-member, which hides the real problem
+		return fmt.Errorf("project '%v' not found or not visible to the token, so its owners can't be checked: %w",
+			v.cfg.ProjectPath, checkErr)
+	}
+	// A parent group owner can still be satisfied by a subgroup that the project is shared with
+	if checkErr == nil && v.cfg.ResolveSubgroups {
+		userAndGroupLeftovers, checkErr = resolveSubgroupOwners(membersGraphqlServer, membersRestServer, v.cfg.ProjectPath, userAndGroupLeftovers)
+	}
+	if errors.Is(checkErr, context.DeadlineExceeded) {
+		checkErr = fmt.Errorf("the members timeout of %d seconds (GITLAB_MEMBERS_TIMEOUT_SECS, or GITLAB_TIMEOUT_SECS if it's not set) ran out: %w",
+			membersTimeout, checkErr)
+	}
+	if checkErr == nil {
+		v.report.Summary.OwnersMissing = len(userAndGroupLeftovers) + len(emailLeftovers)
+		v.report.Summary.OwnersVerified = len(ugList) + len(eList) - v.report.Summary.OwnersMissing
+	}
+	// Find out why each missing owner is missing, so that it's only reported once, by the most specific check. If
+	// the members couldn't be fetched, then none of the owners were checked off, so they aren't classified.
+	unclassifiedLeftovers := userAndGroupLeftovers
+	var renamedGroups, missingGroups, nonexistentOwners, nonMemberOwners []ownerProblem
+	var renamedErr, missingErr, classifyErr error
+	if checkErr == nil {
+		renamedGroups, renamedErr = checkRenamedGroups(restServer, v.cfg.ProjectPath, userAndGroupLeftovers)
+		missingGroups, missingErr = checkGroupsExist(graphqlServer, userAndGroupLeftovers, renamedGroups)
+		nonexistentOwners, nonMemberOwners, classifyErr = classifyOwnerLeftovers(graphqlServer, userAndGroupLeftovers, renamedGroups)
+		unclassifiedLeftovers = removeClassifiedOwners(userAndGroupLeftovers, renamedGroups, missingGroups, nonexistentOwners, nonMemberOwners)
+	}
+	v.recordResults("Direct user and group membership check", ExitCodeOwner, checkErr, unclassifiedLeftovers, "Unable to find:")
+	// Without an admin token, GitLab only finds users by their public email, so unknown emails are only a warning
+	if v.tokenIsAdmin || v.cfg.EmailStrict {
+		v.recordResults("Direct user email membership check", ExitCodeOwner, checkErr, emailLeftovers, "Unable to find:")
+	} else {
+		v.recordWarnings("Direct user email membership check", checkErr, emailLeftovers,
+			"Unable to find (the token is not an admin, so only users with a matching public email can be found):")
+	}
+	if checkErr != nil {
+		for _, checkName := range []string{"Renamed group check", "Group existence check", "Nonexistent owner check", "Non-member owner check"} {
+			v.recordSkipped(checkName, "The project's members could not be fetched, so the missing owners are unknown")
+		}
+	} else {
+		v.recordOwnerProblems("Renamed group check", ExitCodeOwner, renamedErr, renamedGroups, "Groups that were renamed or moved:")
+		v.recordOwnerProblems("Group existence check", ExitCodeOwner, missingErr, missingGroups, "Groups that could not be found:")
+		v.recordOwnerProblems("Nonexistent owner check", ExitCodeOwner, classifyErr, nonexistentOwners, "Users or groups that do not exist (or are not visible to the token):")
+		v.recordOwnerProblems("Non-member owner check", ExitCodeOwner, classifyErr, nonMemberOwners, "Users or groups that exist, but are not direct members of the project:")
+	}
+	// Check that owners who are only members through an invited group can approve, given the group's access level
+	if v.cfg.CheckInvitedAccess {
+		lowAccessOwners, checkErr := checkInvitedGroupAccess(membersRestServer, v.cfg.ProjectPath, ugList, eList)
+		v.recordWarnings("Invited group access check", checkErr, lowAccessOwners,
+			"Owners who can't approve, since they only have access through a group that's shared with less than Developer access:")
+	}
+	// Private groups can't be @-mentioned by non-members, which is a common cause of approval rules not applying
+	if v.cfg.CheckGroupVisibility {
+		privateGroups, checkErr := checkGroupVisibility(graphqlServer, ugList, v.co.OwnerLines)
+		v.recordWarnings("Group visibility check", checkErr, privateGroups,
+			"Group owners with private visibility (approval may not work for users who aren't members of the group):")
+	}
+	// Some orgs only allow owners from a central approvers group
+	if v.cfg.RequiredParentGroup != "" {
+		outsideOwners, checkErr := checkRequiredParentGroup(restServer, v.cfg.RequiredParentGroup, ugList, v.co.OwnerLines)
+		v.recordWarnings("Required parent group check", checkErr, outsideOwners,
+			fmt.Sprintf("Owners that are not members or subgroups of '%v':", v.cfg.RequiredParentGroup))
+	}
+	// Check that group owners have enough members to meet the sections' approval counts (expensive)
+	if v.cfg.CheckApproverCapacity {
+		lowCapacitySections, checkErr := checkApproverCapacity(membersRestServer, v.co.Sections)
+		v.recordWarnings("Approver capacity check", checkErr, lowCapacitySections, "Sections that require more approvals than they have approvers:")
+	}
+	// Walk the working tree once, and match each file pattern against the list, instead of globbing the file
+	// system for each pattern. A bare repo's files are already listed from git.
+	if v.cfg.MatchInMemory && repoFiles == nil {
+		listStart := time.Now()
+		repoFiles, err = listWorkingTreeFiles(v.cfg.RepoRoot)
+		v.recordTiming("Listing files", listStart)
+		if err != nil {
+			return
+		}
+	}
+	// Check file patterns
+	filePatterns := v.co.FilePatterns
+	if v.cfg.FilePatternIgnore != "" {
+		ignoredFilePatterns, readErr := readListFile(v.cfg.FilePatternIgnore)
+		if readErr != nil {
+			return fmt.Errorf("CODEOWNERS_FILE_PATTERN_IGNORE: %w", readErr)
+		}
+		var unusedIgnores []string
+		filePatterns, unusedIgnores = removeIgnoredFilePatterns(filePatterns, ignoredFilePatterns)
+		v.recordWarnings("File pattern ignore list check", nil, unusedIgnores, "Ignore list entries that are not in the CODEOWNERS file:")
+	}
+	filePatterns = slices.DeleteFunc(slices.Clone(filePatterns), func(pattern string) bool {
+		return !slices.Contains(changedFilePatterns, pattern)
+	})
+	traversalPatterns := appendLineNumbers(v.co.FilePatternLines, checkPathTraversal(filePatterns))
+	v.recordWarnings("Path traversal check", nil, traversalPatterns, "File patterns with '..', which can't refer to anything in the repo:")
+	filePatternStart := time.Now()
+	globTimeout := cmp.Or(v.cfg.GlobTimeout, v.cfg.GitlabTimeout)
+	globCtx, cancelGlob := phaseContext(globTimeout)
+	defer cancelGlob()
+	var selfMatchPath string
+	if v.cfg.ExcludeSelfMatch {
+		selfMatchPath = v.co.CodeownersFilePath
+	}
+	badFilePatterns, caseMismatches, checkErr := checkFilePatterns(globCtx, v.cfg.RepoRoot, filePatterns, repoFiles, v.cfg.CaseSensitiveGlob,
+		selfMatchPath)
+	v.recordTiming("File pattern check", filePatternStart)
+	if errors.Is(checkErr, context.DeadlineExceeded) {
+		checkErr = fmt.Errorf("the file pattern timeout of %d seconds (CODEOWNERS_GLOB_TIMEOUT_SECS, or GITLAB_TIMEOUT_SECS if it's not set) ran out: %w",
+			globTimeout, checkErr)
+	}
+	v.recordResults("File pattern check", ExitCodeFilePattern, checkErr, badFilePatterns, "Unable to find:")
+	if v.cfg.CaseSensitiveGlob {
+		v.recordResults("File pattern case check", ExitCodeFilePattern, checkErr, caseMismatches,
+			"File patterns that only match files with a different case, which GitLab won't match:")
+	}
+	if v.cfg.ReportMatchCounts || v.cfg.BroadPatternLimit > 0 {
+		v.checkMatchCounts(filePatterns, repoFiles)
+	}
+	dirPatterns, checkErr := checkDirectoryPatterns(v.cfg.RepoRoot, filePatterns, repoFiles)
+	dirPatterns = appendLineNumbers(v.co.FilePatternLines, dirPatterns)
+	v.recordWarnings("Directory pattern check", checkErr, dirPatterns, "File patterns that name a directory, but only match a file without a trailing slash (ex: /src/app/):")
+	// Check for files that no file pattern matches
+	if v.cfg.ReportUnowned {
+		unownedFiles, checkErr := reportUnownedFiles(v.cfg, v.co.FilePatterns, repoFiles)
+		v.recordWarnings("Unowned file check", checkErr, unownedFiles, "Files and directories without an owner:")
+	}
+	// The author can't approve their own changes, so a changed entry that only they own can't get approval
+	if v.cfg.CheckAuthorOwner {
+		author := cmp.Or(mergeRequestAuthor, v.cfg.Author)
+		switch {
+		case v.cfg.DiffBase == "":
+			v.recordSkipped("Author owner check", "CODEOWNERS_DIFF_BASE is not set, so the changed files are unknown")
+		case author == "":
+			v.recordSkipped("Author owner check", "The author is unknown, since this isn't a merge request pipeline and GITLAB_USER_LOGIN is not set")
+		default:
+			authorOwnedEntries := checkAuthorOwnedEntries(v.co.Sections, changedFilePatterns, author)
+			v.recordWarnings("Author owner check", nil, authorOwnedEntries,
+				fmt.Sprintf("Changed entries whose only owner is the author, @%v, who can't approve their own changes:", author))
+		}
+	}
+	// Check that the CODEOWNERS file will actually be enforced
+	if v.cfg.CheckApprovalSetting {
+		approvalProblems, checkErr := checkApprovalSetting(restServer, v.cfg.ProjectPath, targetBranch)
+		v.recordWarnings("Code owner approval setting check", checkErr, approvalProblems, "Code owner approval is not enforced:")
+	}
+	return
+}
+
+// Locate the CODEOWNERS file, and load it into a new CodeownersFileAnatomy, which is returned. In a bare repo (which has no working tree), the
+// CODEOWNERS file is read out of the git object database at the configured branch instead, and the list of the
+// repo's files is returned so that file patterns can be matched against it. Otherwise, repoFiles is nil. If
+// cfg.Content is set, then it's loaded instead of locating the file. Returns an error if the file isn't valid
+// UTF-8.
+func Locate(cfg Config) (co *analysis.CodeownersFileAnatomy, repoFiles []string, err error) {
+	co = analysis.New(cfg.RepoRoot)
+	co.ExtraLocations = cfg.ExtraLocations
+	repoFiles, err = locate(cfg, co)
+	if err == nil {
+		err = co.CheckEncoding()
+	}
+	return
+}
+
+func locate(cfg Config, co *analysis.CodeownersFileAnatomy) (repoFiles []string, err error) {
+	if cfg.Content != nil {
+		co.CodeownersFilePath = cmp.Or(cfg.ContentSource, "stdin")
+		co.LoadContent(string(cfg.Content))
+		if isBare, _ := gitfiles.IsBareRepo(cfg.RepoRoot); isBare {
+			repoFiles, err = gitfiles.ListFiles(cfg.RepoRoot, cmp.Or(cfg.Branch, "HEAD"))
+		}
+		return
+	}
+	if cfg.CodeownersPath != "" {
+		co.CodeownersFilePath = cfg.CodeownersPath
+		if _, err = os.Stat(filepath.Join(cfg.RepoRoot, cfg.CodeownersPath)); err != nil {
+			err = fmt.Errorf("unable to read CODEOWNERS file at path '%v': %w", cfg.CodeownersPath, err)
+		}
+		return
+	}
+	isBare, err := gitfiles.IsBareRepo(cfg.RepoRoot)
+	if err != nil {
+		// Not a repo, or git isn't installed, so just use the file system
+		slog.Debug("Locate(): assuming there is a working tree: " + err.Error())
+	}
+	if !isBare {
+		return nil, co.DetermineCodeownersPath()
+	}
+	ref := cmp.Or(cfg.Branch, "HEAD") // ex: HEAD for a dry run
+	slog.Debug("Locate(): bare repo detected, reading files from ref '" + ref + "'")
+	repoFiles, err = gitfiles.ListFiles(cfg.RepoRoot, ref)
+	if err == nil {
+		err = co.DetermineCodeownersPathInRepoFiles(repoFiles)
+	}
+	if err == nil {
+		var content string
+		content, err = gitfiles.ReadFile(cfg.RepoRoot, ref, co.CodeownersFilePath)
+		co.LoadContent(content)
+	}
+	return
+}
+
+// Analyze the CODEOWNERS file structure, streaming it in if requested (and if it isn't already loaded)
+func AnalyzeCodeowners(cfg Config, co *analysis.CodeownersFileAnatomy) (err error) {
+	// The whitespace, separator, and line length checks need the raw lines, which aren't kept when streaming
+	needsRawLines := cfg.CheckWhitespace || cfg.CheckSeparator || cfg.MaxLineLength > 0
+	if cfg.StreamParse && !needsRawLines && co.CodeownersFileLines == nil {
+		return co.AnalyzeStreaming()
+	}
+	co.Analyze()
+	return nil
+}
+
+// Return copies of the servers for a phase that has its own timeout, along with the function to call when the
+// phase is done. The phase's requests share a context that's canceled after timeoutSecs, so that the whole phase
+// is limited, rather than each request. Any one request can also take that long, even if it's longer than
+// cfg.GitlabTimeout. The copies still share the servers' transport and rate limiter. No limit if timeoutSecs is 0.
+func withPhaseTimeout(graphqlServer graphql.Server, restServer rest.Server, timeoutSecs int) (graphql.Server, rest.Server,
+	context.CancelFunc,
+) {
+	ctx, cancel := phaseContext(timeoutSecs)
+	graphqlServer.Context = ctx
+	restServer.Context = ctx
+	if timeoutSecs > 0 {
+		graphqlServer.Timeout = timeoutSecs
+		graphqlServer.Client = transport.NewClient(graphqlServer.Transport, timeoutSecs)
+		restServer.Timeout = timeoutSecs
+		restServer.Client = transport.NewClient(restServer.Transport, timeoutSecs)
+	}
+	return graphqlServer, restServer, cancel
+}
+
+// Return a context for a phase (ex: globbing), which is canceled after timeoutSecs, or never if timeoutSecs is 0
+func phaseContext(timeoutSecs int) (ctx context.Context, cancel context.CancelFunc) {
+	if timeoutSecs <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), time.Duration(timeoutSecs)*time.Second)
+}
+
+// Setup GitLab connections - return struct vars with connection info for both of the GitLab API packages.
+// Both packages share the same HTTP transport, so that proxy settings are applied uniformly, and its pooled
+// connections are reused by each server's client.
+func SetupGitlabConnections(cfg Config) (graphqlServer graphql.Server, restServer rest.Server, err error) {
+	sharedTransport := cfg.GitlabTransport
+	if sharedTransport == nil {
+		sharedTransport, err = transport.New(cfg.GitlabProxyUrl)
+		if err != nil {
+			return
+		}
+	}
+	// Both APIs count against the same GitLab rate limit, so they share a limiter
+	sharedLimiter := ratelimit.New(cfg.GitlabRateLimit)
+	graphqlServer = graphql.Server{
+		GraphQlUrl:          cfg.GitlabGraphqlUrl,
+		GitlabToken:         cfg.GitlabToken,
+		FallbackToken:       cfg.GitlabTokenFallback,
+		Timeout:             cfg.GitlabTimeout,
+		Transport:           sharedTransport,
+		Client:              transport.NewClient(sharedTransport, cfg.GitlabTimeout), // One pooled client per server
+		RateLimiter:         sharedLimiter,
+		ExtraHeaders:        cfg.GitlabExtraHeaders,
+		AllowPartialResults: cfg.AllowPartialResults,
+	}
+	restServer = rest.Server{
+		RestUrl:       cfg.GitlabRestUrl,
+		GitlabToken:   cfg.GitlabToken,
+		FallbackToken: cfg.GitlabTokenFallback,
+		Timeout:       cfg.GitlabTimeout,
+		Transport:     sharedTransport,
+		Client:        transport.NewClient(sharedTransport, cfg.GitlabTimeout), // One pooled client per server
+		RateLimiter:   sharedLimiter,
+		ExtraHeaders:  cfg.GitlabExtraHeaders,
+		ProjectCache:  rest.NewProjectCache(), // Several checks need the project
+	}
+	return
+}
+
+// Returns true if the results of a check indicate a pass (no error and leftovers is empty).
+// Returns false for failure(s). Records the results (with a fingerprint for each failure) in the report.
+// failureExitCode is the exit code for the check's category, which is used if the check fails due to its
+// leftovers.
+func (v *validator) recordResults(checkName string, failureExitCode int, err error, leftovers []string, leftoverMsg string) (passed bool) {
+	result := newCheckResult(v.co, checkName, failureExitCode, err, leftovers, leftoverMsg)
+	v.record(result)
+	return result.Status == StatusPassed
+}
+
+// Just like recordResults(), except that the leftovers are owner problems, whose details are kept in their findings
+func (v *validator) recordOwnerProblems(checkName string, failureExitCode int, err error, problems []ownerProblem, leftoverMsg string) (passed bool) {
+	result := newOwnerProblemResult(v.co, checkName, failureExitCode, err, problems, leftoverMsg)
+	v.record(result)
+	return result.Status == StatusPassed
+}
+
+// Just like recordResults(), except that a failure is only reported as a warning (which does not affect the exit
+// code), unless cfg.Strict is enabled.
+func (v *validator) recordWarnings(checkName string, err error, leftovers []string, leftoverMsg string) (passed bool) {
+	result := newWarningResult(v.co, checkName, err, leftovers, leftoverMsg, v.cfg.Strict)
+	v.record(result)
+	return result.Status == StatusPassed
+}
+
+// Record a check that was skipped, along with the reason. A skipped check doesn't affect the exit code.
+func (v *validator) recordSkipped(checkName string, reason string) {
+	result := CheckResult{Name: checkName, Status: StatusSkipped, Message: reason, Findings: []Finding{}}
+	v.record(result)
+}
+
+// Add a check's result to the report, and pass it to cfg.OnResult (if set)
+func (v *validator) record(result CheckResult) {
+	v.report.Checks = append(v.report.Checks, result)
+	if v.cfg.OnResult != nil {
+		v.cfg.OnResult(result)
+	}
+}
+
+// Return the file patterns that match a file changed since cfg.DiffBase (or a directory that contains one), so
+// that a merge request's run only checks the patterns that it could affect. Returns all of the file patterns if
+// cfg.DiffBase isn't set, or if git can't diff against it (ex: it wasn't fetched), which is noted in the report.
+func (v *validator) changedFilePatterns(filePatterns []string, repoFiles []string) (changedPatterns []string, err error) {
+	if v.cfg.DiffBase == "" {
+		return filePatterns, nil
+	}
+	ref := "HEAD"
+	if repoFiles != nil {
+		// A bare repo's HEAD isn't necessarily the branch being validated
+		ref = cmp.Or(v.cfg.Branch, "HEAD")
+	}
+	changedFiles, diffErr := gitfiles.ChangedFiles(v.cfg.RepoRoot, v.cfg.DiffBase, ref)
+	if diffErr != nil {
+		v.report.Notes = append(v.report.Notes, fmt.Sprintf("Unable to list the files changed since CODEOWNERS_DIFF_BASE "+
+			"'%v', so all file patterns are checked: %v", v.cfg.DiffBase, diffErr))
+		return filePatterns, nil
+	}
+	// A pattern can match a directory, which owns all of the files under it
+	changedPaths := slices.Clone(changedFiles)
+	seenDirs := map[string]bool{}
+	for _, file := range changedFiles {
+		// Stop at the first directory that's already been added, since its parents have been added too
+		for dir := path.Dir(file); dir != "." && !seenDirs[dir]; dir = path.Dir(dir) {
+			seenDirs[dir] = true
+			changedPaths = append(changedPaths, dir)
+		}
+	}
+	for _, pattern := range filePatterns {
+		matches, matchErr := matchRepoFiles(v.cfg.RepoRoot, TranslateCoToGlob(v.cfg.RepoRoot, pattern), changedPaths)
+		if matchErr != nil {
+			return nil, fmt.Errorf("changedFilePatterns() error while evaluating glob '%v': %w", pattern, matchErr)
+		}
+		if len(matches) > 0 {
+			changedPatterns = append(changedPatterns, pattern)
+		}
+	}
+	v.report.Notes = append(v.report.Notes, fmt.Sprintf("Only the %d of %d file patterns that match the %v changed "+
+		"since '%v' are checked", len(changedPatterns), len(filePatterns), CountOf(len(changedFiles), "file"), v.cfg.DiffBase))
+	return
+}
+
+// Report how many files each file pattern matches (if cfg.ReportMatchCounts is set), and warn about patterns that
+// match more than cfg.BroadPatternLimit files (if it's set), which may give their owners more than intended
+func (v *validator) checkMatchCounts(filePatterns []string, repoFiles []string) {
+	counts, err := countFilePatternMatches(v.cfg.RepoRoot, filePatterns, repoFiles)
+	if v.cfg.ReportMatchCounts {
+		result := CheckResult{Name: "File pattern match counts", Status: StatusPassed, Findings: []Finding{}}
+		if err != nil {
+			result = newCheckResult(v.co, result.Name, ExitCodeInternal, err, nil, "")
+		} else {
+			result.Message = "Files matched by each file pattern (most first):"
+		}
+		for _, count := range counts {
+			result.Findings = append(result.Findings, newFinding(v.co, result.Name, count.pattern+" matches "+CountOf(count.files, "file")))
+		}
+		v.record(result)
+	}
+	if v.cfg.BroadPatternLimit > 0 {
+		var broadPatterns []string
+		for _, count := range counts {
+			// The catch-all "*" pattern is expected to match everything
+			if count.files > v.cfg.BroadPatternLimit && count.pattern != "*" {
+				broadPatterns = append(broadPatterns, fmt.Sprintf("%v on lines: %v (%v)", count.pattern,
+					FormatLineNumbers(v.co.FilePatternLines[count.pattern]), CountOf(count.files, "file")))
+			}
+		}
+		msg := fmt.Sprintf("File patterns that match more than %d files, which may give their owners more than intended:", v.cfg.BroadPatternLimit)
+		v.recordWarnings("Broad file pattern check", err, broadPatterns, msg)
+	}
+}
+
+// Return the count followed by the noun, which is made plural unless the count is 1, ex: "3 files"
+func CountOf(count int, noun string) string {
+	if count == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", count, noun)
+}
+
+// Describe which emails the token can find, and how the ones it can't are reported
+func emailSearchNote(tokenIsAdmin bool, emailStrict bool) string {
+	switch {
+	case tokenIsAdmin:
+		return "The token is an admin, so the email search includes private emails"
+	case emailStrict:
+		return "The token is not an admin, so only public emails can be searched, and CODEOWNERS_EMAIL_STRICT fails any others"
+	default:
+		return "The token is not an admin, so only public emails can be searched, and any others are only a warning"
+	}
+}
+
+// Record how long a phase took, given its start time. Call with defer, ex:
+// defer v.recordTiming("Syntax check", time.Now())
+func (v *validator) recordTiming(phase string, start time.Time) {
+	duration := time.Since(start)
+	slog.Debug(fmt.Sprintf("Timing: '%v' took %v", phase, duration))
+	v.timingsMutex.Lock()
+	defer v.timingsMutex.Unlock()
+	v.phaseTimings = append(v.phaseTimings, PhaseTiming{Phase: phase, Duration: duration})
+}
+
+// Return a copy of the phase timings recorded so far. A member fetch that checkOwners() didn't need may still be
+// running, and record its timing after Validate() returns, so they're kept out of v.report until they're copied.
+func (v *validator) timings() []PhaseTiming {
+	v.timingsMutex.Lock()
+	defer v.timingsMutex.Unlock()
+	return slices.Clone(v.phaseTimings)
+}
+
+// Return the repo's files (or directories) that aren't owned by any file pattern, skipping the paths in the
+// CODEOWNERS_UNOWNED_IGNORE list.
+func reportUnownedFiles(cfg Config, filePatterns []string, repoFiles []string) (unownedFiles []string, err error) {
+	var ignoredPaths []string
+	if cfg.UnownedIgnore != "" {
+		ignoredPaths, err = readUnownedIgnoreList(cfg.UnownedIgnore)
+		if err != nil {
+			err = fmt.Errorf("reportUnownedFiles() CODEOWNERS_UNOWNED_IGNORE: %w", err)
+			return
+		}
+	}
+	return findUnownedFiles(cfg.RepoRoot, filePatterns, repoFiles, ignoredPaths)
+}
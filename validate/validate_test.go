@@ -0,0 +1,319 @@
+package validate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gitlab.com/tedspinks/validate-codeowners/graphql"
+	"gitlab.com/tedspinks/validate-codeowners/rest"
+	"gitlab.com/tedspinks/validate-codeowners/testutil"
+)
+
+// Start a fake GitLab with a "my-group/my-project" project, whose direct members are alice and bob, and which is
+// shared with the "my-group/team" group, whose member is dave. Its main and release/* branches require code owner
+// approval, and stable/1.0 does too, but not the rest of stable/*. Stopped when the test ends.
+func startFakeGitLab(t *testing.T) *testutil.GitLab {
+	t.Helper()
+	alice := rest.Member{Id: 1, Username: "alice", PublicEmail: "alice@example.com"}
+	bob := rest.Member{Id: 2, Username: "bob"}
+	dave := rest.Member{Id: 4, Username: "dave"}
+	gitlab := &testutil.GitLab{
+		Projects: map[string]rest.Project{"my-group/my-project": {Id: 100, PathWithNamespace: "my-group/my-project",
+			SharedWithGroups: []rest.Group{{GroupId: 10, GroupName: "team", GroupFullPath: "my-group/team"}}}},
+		DirectMembers: map[string][]rest.Member{"my-group/my-project": {alice, bob}},
+		GroupMembers:  map[int][]rest.Member{10: {dave}},
+		Groups:        []rest.GroupDetails{{Id: 10, Name: "team", FullPath: "my-group/team"}},
+		Users:         []rest.Member{alice, bob, dave},
+		TokenUser:     rest.User{Username: "alice"},
+		ProtectedBranches: map[string][]rest.ProtectedBranch{"my-group/my-project": {
+			{Id: 1, Name: "main", CodeOwnerApprovalRequired: true},
+			{Id: 2, Name: "release/*", CodeOwnerApprovalRequired: true},
+			{Id: 3, Name: "stable/*"},
+			{Id: 4, Name: "stable/1.0", CodeOwnerApprovalRequired: true},
+		}},
+	}
+	gitlab.Start()
+	t.Cleanup(gitlab.Close)
+	return gitlab
+}
+
+// Return the GraphQL and REST servers for the fake GitLab
+func fakeServers(gitlab *testutil.GitLab) (graphql.Server, rest.Server) {
+	return graphql.Server{GraphQlUrl: gitlab.GraphQlUrl(), GitlabToken: "test-token", Timeout: 5},
+		rest.Server{RestUrl: gitlab.RestUrl(), GitlabToken: "test-token", Timeout: 5}
+}
+
+// Return a new repo root with the CODEOWNERS content, and an empty file at each of the other paths
+func newTestRepo(t *testing.T, codeowners string, paths ...string) (repoRoot string) {
+	t.Helper()
+	repoRoot = t.TempDir()
+	for _, p := range append(paths, "CODEOWNERS") {
+		fullPath := filepath.Join(repoRoot, p)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		content := ""
+		if p == "CODEOWNERS" {
+			content = codeowners
+		}
+		if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return
+}
+
+// Return a config for validating the repo against the fake GitLab
+func testConfig(gitlab *testutil.GitLab, repoRoot string) Config {
+	return Config{
+		ProjectPath:      "my-group/my-project",
+		Branch:           "main",
+		GitlabGraphqlUrl: gitlab.GraphQlUrl(),
+		GitlabRestUrl:    gitlab.RestUrl(),
+		GitlabToken:      "test-token",
+		GitlabTimeout:    5,
+		RepoRoot:         repoRoot,
+	}
+}
+
+// Return the check with the name, failing the test if it didn't run
+func findCheck(t *testing.T, report Report, name string) CheckResult {
+	t.Helper()
+	for _, check := range report.Checks {
+		if check.Name == name {
+			return check
+		}
+	}
+	t.Fatalf("check %q didn't run, the checks were: %v", name, report.Checks)
+	return CheckResult{}
+}
+
+// Return the values of the check's findings
+func findingValues(check CheckResult) (values []string) {
+	for _, finding := range check.Findings {
+		values = append(values, finding.Value)
+	}
+	return
+}
+
+func TestOwnershipReportKeepsHeadingOnlySections(t *testing.T) {
+	gitlab := startFakeGitLab(t)
+	repoRoot := newTestRepo(t, "[Docs] @alice\n*.md\n\n[Future] @bob\n", "README.md")
+	cfg := testConfig(gitlab, repoRoot)
+	cfg.OwnershipReport = filepath.Join(t.TempDir(), "ownership.txt")
+
+	_, err := Validate(cfg)
+	if err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	ownership, err := os.ReadFile(cfg.OwnershipReport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, heading := range []string{"[Docs]", "[Future]"} {
+		if !strings.Contains(string(ownership), heading) {
+			t.Errorf("ownership report is missing %v, since CODEOWNERS_DIFF_BASE isn't set:\n%s", heading, ownership)
+		}
+	}
+}
+
+func TestPhaseTimeoutLimitsTheWholePhase(t *testing.T) {
+	var slowGitLab *httptest.Server
+	slowGitLab = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(300 * time.Millisecond)
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		w.Header().Set("Link", fmt.Sprintf(`<%v/api/v4/items?page=%d>; rel="next"`, slowGitLab.URL, page+1))
+		fmt.Fprint(w, "[]")
+	}))
+	defer slowGitLab.Close()
+	graphqlServer := graphql.Server{GraphQlUrl: slowGitLab.URL + "/api/graphql", Timeout: 5}
+	restServer := rest.Server{RestUrl: slowGitLab.URL + "/api/v4", Timeout: 5}
+
+	_, phaseRestServer, cancel := withPhaseTimeout(graphqlServer, restServer, 1)
+	defer cancel()
+	// Each page is well within the timeout, but all the pages aren't
+	start := time.Now()
+	_, _, err := phaseRestServer.RestRequestAllPages("items")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("RestRequestAllPages() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("RestRequestAllPages() took %v, want it to stop after the 1 second phase timeout", elapsed)
+	}
+}
+
+func TestCountOf(t *testing.T) {
+	tests := []struct {
+		count int
+		noun  string
+		want  string
+	}{
+		{0, "file", "0 files"},
+		{1, "file", "1 file"},
+		{12, "owner", "12 owners"},
+	}
+	for _, tt := range tests {
+		if got := CountOf(tt.count, tt.noun); got != tt.want {
+			t.Errorf("CountOf(%d, %q) = %q, want %q", tt.count, tt.noun, got, tt.want)
+		}
+	}
+}
+
+func TestGitlabProxyUrlIsUsedByBothApis(t *testing.T) {
+	gitlab := startFakeGitLab(t)
+	gitlabUrl, err := url.Parse(gitlab.RestUrl())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var proxiedMutex sync.Mutex
+	var proxiedPaths []string
+	forwarder := httputil.NewSingleHostReverseProxy(&url.URL{Scheme: gitlabUrl.Scheme, Host: gitlabUrl.Host})
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxiedMutex.Lock()
+		proxiedPaths = append(proxiedPaths, r.URL.Path)
+		proxiedMutex.Unlock()
+		forwarder.ServeHTTP(w, r)
+	}))
+	defer proxy.Close()
+	cfg := testConfig(gitlab, "")
+	cfg.GitlabProxyUrl = proxy.URL
+
+	graphqlServer, restServer, err := SetupGitlabConnections(cfg)
+	if err != nil {
+		t.Fatalf("SetupGitlabConnections() error = %v", err)
+	}
+	if _, err := graphqlServer.GroupExists("my-group/team"); err != nil {
+		t.Fatalf("GroupExists() error = %v", err)
+	}
+	if _, err := restServer.GetProjectByPath("my-group/my-project"); err != nil {
+		t.Fatalf("GetProjectByPath() error = %v", err)
+	}
+	want := []string{"/api/graphql", "/api/v4/projects/my-group/my-project"}
+	if !slices.Equal(proxiedPaths, want) {
+		t.Errorf("the proxy got requests for %v, want %v", proxiedPaths, want)
+	}
+}
+
+func TestUnusedOwnerCheck(t *testing.T) {
+	gitlab := startFakeGitLab(t)
+	codeowners := "[Replaced] @bob\n*.md @alice\n\n[No Entries] @dave\n\n[Used] @alice\n*.txt\n"
+	repoRoot := newTestRepo(t, codeowners, "README.md", "notes.txt")
+	cfg := testConfig(gitlab, repoRoot)
+	cfg.CheckUnusedOwners = true
+
+	report, err := Validate(cfg)
+	if err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	// bob's default is replaced by the entry's own owner, and dave's section has no entries
+	want := []string{"bob on lines: 1", "dave on lines: 4"}
+	if got := findingValues(findCheck(t, report, "Unused owner check")); !slices.Equal(got, want) {
+		t.Errorf("Unused owner check findings = %v, want %v", got, want)
+	}
+}
+
+// A groupChecker and userChecker whose user member fetches are slow
+type slowUserMembers struct{}
+
+func (slowUserMembers) GetDirectGroupMembers(projectFullPath string) (groups []string, err error) {
+	return []string{"my-group/team"}, nil
+}
+
+func (slowUserMembers) GetDirectUserMembers(projectFullPath string, userSource string) (
+	usernamesFound []string,
+	emailsFound []string,
+	err error,
+) {
+	time.Sleep(50 * time.Millisecond)
+	return nil, nil, nil
+}
+
+func TestTimingsAreReadWhileFetchesFinish(t *testing.T) {
+	v := &validator{}
+	// Every owner is a group, so checkOwners() returns without waiting for the user member fetches
+	_, _, err := v.checkOwners(slowUserMembers{}, slowUserMembers{}, "my-group/my-project", []string{"my-group/team"}, nil, "")
+	if err != nil {
+		t.Fatalf("checkOwners() error = %v", err)
+	}
+	// Run with -race to catch an unlocked read, while the user member fetches record their timings
+	deadline := time.Now().Add(200 * time.Millisecond)
+	for len(v.timings()) < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if got := len(v.timings()); got != 3 {
+		t.Errorf("len(timings()) = %d, want 3, one for each member fetch", got)
+	}
+}
+
+func TestOwnersAreNotClassifiedWhenMembersCantBeFetched(t *testing.T) {
+	gitlab := startFakeGitLab(t)
+	failingGitLab := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), "projectMembers") {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		gitlab.ServeHTTP(w, r)
+	}))
+	defer failingGitLab.Close()
+	repoRoot := newTestRepo(t, "*.md @alice @bob @my-group/team\n", "README.md")
+	cfg := testConfig(gitlab, repoRoot)
+	cfg.GitlabGraphqlUrl = failingGitLab.URL + "/api/graphql"
+
+	report, err := Validate(cfg)
+	if err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if check := findCheck(t, report, "Direct user and group membership check"); check.Error == "" {
+		t.Errorf("Direct user and group membership check = %+v, want the fetch's error", check)
+	}
+	// The owners are all members, so they'd be misreported if they were classified
+	for _, checkName := range []string{"Renamed group check", "Group existence check", "Nonexistent owner check", "Non-member owner check"} {
+		if check := findCheck(t, report, checkName); check.Status != StatusSkipped {
+			t.Errorf("%v status = %v, want %v", checkName, check.Status, StatusSkipped)
+		}
+	}
+}
+
+func TestValidateReturnsWhileMemberFetchesFinish(t *testing.T) {
+	gitlab := startFakeGitLab(t)
+	slowGitLab := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), "projectMembers") {
+			time.Sleep(100 * time.Millisecond)
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		gitlab.ServeHTTP(w, r)
+	}))
+	defer slowGitLab.Close()
+	// The only owner is a group, so checkOwners() returns without waiting for the user member fetches
+	repoRoot := newTestRepo(t, "*.md @my-group/team\n", "README.md")
+	cfg := testConfig(gitlab, repoRoot)
+	cfg.GitlabGraphqlUrl = slowGitLab.URL + "/api/graphql"
+
+	// Run with -race to catch the timings being read without their lock, while the user member fetches record theirs
+	report, err := Validate(cfg)
+	if err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	time.Sleep(200 * time.Millisecond) // For the user member fetches to finish, and record their timings
+	if !slices.ContainsFunc(report.Timings, func(timing PhaseTiming) bool { return timing.Phase == "Group members" }) {
+		t.Errorf("Timings = %v, want the group members fetch", report.Timings)
+	}
+}
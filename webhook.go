@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+
+	"gitlab.com/tedspinks/validate-codeowners/transport"
+)
+
+// Used when GITLAB_TIMEOUT_SECS isn't read, ex: when merging reports
+const defaultWebhookTimeoutSecs = 30
+
+// POST the report to the webhook through the transport t, as the same JSON as CODEOWNERS_JSON_REPORT, so that other
+// tools (ex: a dashboard or a chat bot) can act on the results. Any 2xx status is a success. The URL is left out of
+// the errors, since webhook URLs often have a secret in them.
+func postWebhook(webhookUrl string, headers http.Header, t http.RoundTripper, timeoutSecs int) (err error) {
+	reportJson, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("postWebhook() could not encode the report: %w", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, webhookUrl, bytes.NewReader(reportJson))
+	if err != nil {
+		return errors.New("postWebhook() CODEOWNERS_WEBHOOK_URL is not a valid URL")
+	}
+	for key, values := range headers {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := transport.NewClient(t, cmp.Or(timeoutSecs, defaultWebhookTimeoutSecs)).Do(req)
+	if err != nil {
+		// Unwrap the *url.Error, since its message includes the URL
+		var urlErr *neturl.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("postWebhook() unable to POST the report to CODEOWNERS_WEBHOOK_URL: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("postWebhook() POST to CODEOWNERS_WEBHOOK_URL returned status %d", res.StatusCode)
+	}
+	return nil
+}